@@ -0,0 +1,401 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrConflict - Matched by errors.Is when an update lost an optimistic locking race
+var ErrConflict = errors.New("version conflict")
+
+// ErrNoVersion - Returned by Update for a replacement without a positive version when Versioning is on
+var ErrNoVersion = errors.New("replacement has no version")
+
+// ConflictError - Returned when the version of the updated document is not the expected one
+type ConflictError struct {
+	Collection string
+	Expected   interface{}
+}
+
+func (e *ConflictError) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("version conflict in %s: document already exists", e.Collection)
+	}
+	return fmt.Sprintf("version conflict in %s: document is no longer at version %v", e.Collection, e.Expected)
+}
+
+// Is - Is
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Behaviors - Opt-in document behaviors of a Repository, field names default to the values in brackets
+type Behaviors struct {
+	// Timestamps sets CreatedField [createdAt] on insert and UpdatedField [updatedAt] on every write.
+	// Replacements keep the stored creation time, they are sent as a pipeline update needing MongoDB 4.2.
+	Timestamps   bool
+	CreatedField string
+	UpdatedField string
+	// SoftDelete makes Delete set DeletedField [deletedAt] instead of removing the document,
+	// queries skip deleted documents unless the filter mentions DeletedField or WithDeleted is used
+	SoftDelete   bool
+	DeletedField string
+	// Versioning sets VersionField [version] to 1 on insert and increments it on every update.
+	// Updates whose selector, or replacement document, carries the version only apply to that
+	// version and return a *ConflictError otherwise. Update rejects replacements without a version
+	// with ErrNoVersion, Upsert only inserts them and returns a *ConflictError if the document exists.
+	// Upserts selecting by fields other than _id should have a unique index on them, see Upsert.
+	Versioning   bool
+	VersionField string
+}
+
+func (b Behaviors) created() string {
+	if b.CreatedField != "" {
+		return b.CreatedField
+	}
+	return "createdAt"
+}
+
+func (b Behaviors) updated() string {
+	if b.UpdatedField != "" {
+		return b.UpdatedField
+	}
+	return "updatedAt"
+}
+
+func (b Behaviors) deleted() string {
+	if b.DeletedField != "" {
+		return b.DeletedField
+	}
+	return "deletedAt"
+}
+
+func (b Behaviors) version() string {
+	if b.VersionField != "" {
+		return b.VersionField
+	}
+	return "version"
+}
+
+// WithBehaviors - Returns a copy of the repository with the given behaviors
+func (r *Repository[T]) WithBehaviors(b Behaviors) *Repository[T] {
+	c := *r
+	c.Behaviors = b
+	return &c
+}
+
+// WithDeleted - Returns a copy of the repository whose queries include soft deleted documents
+func (r *Repository[T]) WithDeleted() *Repository[T] {
+	c := *r
+	c.withDeleted = true
+	return &c
+}
+
+// filter - Returns query restricted to documents that are not soft deleted
+func (r *Repository[T]) filter(query map[string]interface{}) map[string]interface{} {
+	if !r.Behaviors.SoftDelete || r.withDeleted {
+		return query
+	}
+	field := r.Behaviors.deleted()
+	if _, ok := query[field]; ok {
+		return query
+	}
+	filter := make(bson.M, len(query)+1)
+	for k, v := range query {
+		filter[k] = v
+	}
+	// Matches both missing and null
+	filter[field] = nil
+	return filter
+}
+
+// pipeline - Prepends the soft delete filter to an aggregation
+func (r *Repository[T]) pipeline(pipeline []bson.M) []bson.M {
+	if !r.Behaviors.SoftDelete || r.withDeleted {
+		return pipeline
+	}
+	return append([]bson.M{{"$match": bson.M{r.Behaviors.deleted(): nil}}}, pipeline...)
+}
+
+// insertDoc - Returns object as a document with timestamps and the initial version
+func (r *Repository[T]) insertDoc(object T) (interface{}, error) {
+	b := r.Behaviors
+	if !b.Timestamps && !b.Versioning {
+		return object, nil
+	}
+	doc, err := toDoc(object)
+	if err != nil {
+		return nil, err
+	}
+	if b.Timestamps {
+		now := time.Now().UTC()
+		doc = setElem(doc, b.created(), now)
+		doc = setElem(doc, b.updated(), now)
+	}
+	if b.Versioning {
+		doc = setElem(doc, b.version(), int64(1))
+	}
+	return doc, nil
+}
+
+// prepareUpdate - Applies the soft delete filter, timestamps and versioning to an update or replacement
+func (r *Repository[T]) prepareUpdate(selector map[string]interface{}, update interface{}, upsert bool) (map[string]interface{}, interface{}, error) {
+	b := r.Behaviors
+	filter := r.filter(selector)
+	if !b.Timestamps && !b.Versioning {
+		return filter, update, nil
+	}
+	now := time.Now().UTC()
+
+	if isOperatorDoc(update) {
+		ops, ok := operatorDoc(update)
+		if !ok {
+			// Pipeline updates are passed through
+			return filter, update, nil
+		}
+		if b.Timestamps {
+			addOp(ops, "$set", b.updated(), now)
+			if upsert {
+				addOp(ops, "$setOnInsert", b.created(), now)
+			}
+		}
+		if b.Versioning {
+			addOp(ops, "$inc", b.version(), 1)
+		}
+		return filter, ops, nil
+	}
+
+	doc, err := toDoc(update)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.Timestamps {
+		doc = setElem(doc, b.updated(), now)
+		doc = removeElem(doc, b.created())
+	}
+	if b.Versioning {
+		version, _ := lookupElem(doc, b.version())
+		n, _ := toInt64(version)
+		switch {
+		case n > 0:
+			filter = withField(filter, b.version(), version)
+		case upsert:
+			// Without a version the replacement may only create the document
+			filter = withField(filter, b.version(), nil)
+			n = 0
+		default:
+			// Replacing whatever version is stored would silently lose its updates
+			return nil, nil, ErrNoVersion
+		}
+		doc = setElem(doc, b.version(), n+1)
+	}
+	if b.Timestamps {
+		return filter, keepCreated(doc, b.created(), now), nil
+	}
+	return filter, doc, nil
+}
+
+// keepCreated - Pipeline replacing a document with doc while keeping its creation time, or setting it to now on insert.
+// doc is a $literal so that its string values starting with $ are not read as field paths.
+func keepCreated(doc bson.D, created string, now time.Time) []bson.M {
+	return []bson.M{{"$replaceWith": bson.M{"$mergeObjects": bson.A{
+		bson.M{"_id": "$_id"},
+		bson.M{"$literal": doc},
+		bson.M{created: bson.M{"$ifNull": bson.A{"$" + created, now}}},
+	}}}}
+}
+
+// notMatched - Tells ErrConflict from ErrNotFound after an update matched nothing
+func (r *Repository[T]) notMatched(ctx context.Context, filter map[string]interface{}) error {
+	conflict, err := r.versionConflict(ctx, filter, nil)
+	if err != nil {
+		return err
+	}
+	if conflict != nil {
+		return conflict
+	}
+	return ErrNotFound
+}
+
+// versionConflict - Returns a *ConflictError if a document other than the one with _id exclude
+// matches filter at another version than the expected one
+func (r *Repository[T]) versionConflict(ctx context.Context, filter map[string]interface{}, exclude interface{}) (*ConflictError, error) {
+	field := r.Behaviors.version()
+	expected, ok := filter[field]
+	if !r.Behaviors.Versioning || !ok {
+		return nil, nil
+	}
+	rest := make(bson.M, len(filter)+1)
+	for k, v := range filter {
+		if k != field {
+			rest[k] = v
+		}
+	}
+	if exclude != nil {
+		rest["_id"] = bson.M{"$ne": exclude}
+	}
+	found, err := exists(ctx, r.collection(), rest)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &ConflictError{Collection: r.Collection, Expected: expected}, nil
+}
+
+// softDeleteUpdate - Update marking a document deleted
+func (r *Repository[T]) softDeleteUpdate() bson.M {
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{r.Behaviors.deleted(): now}}
+	if r.Behaviors.Timestamps {
+		addOp(update, "$set", r.Behaviors.updated(), now)
+	}
+	if r.Behaviors.Versioning {
+		addOp(update, "$inc", r.Behaviors.version(), 1)
+	}
+	return update
+}
+
+// HardDelete - Removes the first document matching selector even with SoftDelete, ErrNotFound if there is none
+func (r *Repository[T]) HardDelete(ctx context.Context, selector map[string]interface{}) error {
+	res, err := r.collection().DeleteOne(ctx, filterOf(selector))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Restore - Clears the deletion of the first soft deleted document matching selector
+func (r *Repository[T]) Restore(ctx context.Context, selector map[string]interface{}) error {
+	field := r.Behaviors.deleted()
+	filter := withField(selector, field, bson.M{"$ne": nil})
+	update := bson.M{"$unset": bson.M{field: ""}}
+	if r.Behaviors.Timestamps {
+		addOp(update, "$set", r.Behaviors.updated(), time.Now().UTC())
+	}
+	if r.Behaviors.Versioning {
+		addOp(update, "$inc", r.Behaviors.version(), 1)
+	}
+	res, err := r.collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// toDoc - Converts a struct or map to an ordered document
+func toDoc(v interface{}) (bson.D, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	err = bson.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func lookupElem(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func setElem(doc bson.D, key string, value interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+func removeElem(doc bson.D, key string) bson.D {
+	out := doc[:0:0]
+	for _, e := range doc {
+		if e.Key != key {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// withField - Returns a copy of m with key set
+func withField(m map[string]interface{}, key string, value interface{}) bson.M {
+	out := make(bson.M, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
+
+// operatorDoc - Copies an update document so operators can be added without changing the caller's
+func operatorDoc(update interface{}) (bson.M, bool) {
+	out := bson.M{}
+	switch u := update.(type) {
+	case map[string]interface{}:
+		for k, v := range u {
+			out[k] = v
+		}
+	case bson.M:
+		for k, v := range u {
+			out[k] = v
+		}
+	case bson.D:
+		for _, e := range u {
+			out[e.Key] = e.Value
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+// addOp - Sets field in the operator op of update, copying the operator document
+func addOp(update bson.M, op, field string, value interface{}) {
+	fields := bson.M{}
+	switch existing := update[op].(type) {
+	case map[string]interface{}:
+		for k, v := range existing {
+			fields[k] = v
+		}
+	case bson.M:
+		for k, v := range existing {
+			fields[k] = v
+		}
+	case bson.D:
+		for _, e := range existing {
+			fields[e.Key] = e.Value
+		}
+	}
+	if _, ok := fields[field]; !ok {
+		fields[field] = value
+	}
+	update[op] = fields
+}
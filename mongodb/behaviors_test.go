@@ -0,0 +1,208 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+type versioned struct {
+	ID      int    `bson:"_id"`
+	Name    string `bson:"name"`
+	Version int64  `bson:"version,omitempty"`
+}
+
+func TestPrepareReplacement(t *testing.T) {
+	repo := (&Repository[versioned]{Collection: "items"}).WithBehaviors(Behaviors{Versioning: true})
+	tests := []struct {
+		name        string
+		doc         versioned
+		upsert      bool
+		wantFilter  bson.M
+		wantVersion int64
+		wantErr     error
+	}{
+		{"versioned", versioned{ID: 1, Version: 3}, false, bson.M{"_id": 1, "version": int64(3)}, 4, nil},
+		{"versioned upsert", versioned{ID: 1, Version: 3}, true, bson.M{"_id": 1, "version": int64(3)}, 4, nil},
+		{"no version", versioned{ID: 1}, false, nil, 0, ErrNoVersion},
+		{"no version upsert", versioned{ID: 1}, true, bson.M{"_id": 1, "version": nil}, 1, nil},
+		{"negative version upsert", versioned{ID: 1, Version: -2}, true, bson.M{"_id": 1, "version": nil}, 1, nil},
+	}
+	for _, tt := range tests {
+		filter, update, err := repo.prepareUpdate(bson.M{"_id": 1}, tt.doc, tt.upsert)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(bson.M(filter), tt.wantFilter) {
+			t.Errorf("%s: filter = %v, want %v", tt.name, filter, tt.wantFilter)
+		}
+		if version, _ := lookupElem(update.(bson.D), "version"); version != tt.wantVersion {
+			t.Errorf("%s: version = %v, want %d", tt.name, version, tt.wantVersion)
+		}
+	}
+}
+
+func TestPrepareReplacementTimestamps(t *testing.T) {
+	type timestamped struct {
+		ID        int       `bson:"_id"`
+		Name      string    `bson:"name"`
+		Version   int64     `bson:"version"`
+		CreatedAt time.Time `bson:"createdAt"`
+	}
+	repo := (&Repository[timestamped]{Collection: "items"}).WithBehaviors(Behaviors{Timestamps: true, Versioning: true})
+	filter, update, err := repo.prepareUpdate(bson.M{"_id": 1}, timestamped{ID: 1, Name: "$name", Version: 2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (bson.M{"_id": 1, "version": int64(2)}); !reflect.DeepEqual(bson.M(filter), want) {
+		t.Errorf("filter = %v, want %v", filter, want)
+	}
+	// The zero createdAt of the replacement must not overwrite the stored one
+	pipeline, ok := update.([]bson.M)
+	if !ok || len(pipeline) != 1 || !isOperatorDoc(update) {
+		t.Fatalf("update = %v, want a one stage pipeline", update)
+	}
+	merge := pipeline[0]["$replaceWith"].(bson.M)["$mergeObjects"].(bson.A)
+	doc := merge[1].(bson.M)["$literal"].(bson.D)
+	if _, ok := lookupElem(doc, "createdAt"); ok {
+		t.Errorf("replacement %v sets createdAt", doc)
+	}
+	if name, _ := lookupElem(doc, "name"); name != "$name" {
+		t.Errorf("name = %v", name)
+	}
+	if version, _ := lookupElem(doc, "version"); version != int64(3) {
+		t.Errorf("version = %v, want 3", version)
+	}
+	updated, _ := lookupElem(doc, "updatedAt")
+	created := merge[2].(bson.M)["createdAt"].(bson.M)["$ifNull"].(bson.A)
+	if created[0] != "$createdAt" || created[1] != updated {
+		t.Errorf("createdAt = %v, want the stored value or updatedAt %v", created, updated)
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	if err := (&ConflictError{Collection: "items", Expected: int64(2)}); !errors.Is(err, ErrConflict) {
+		t.Errorf("%v does not match ErrConflict", err)
+	}
+	if got, want := (&ConflictError{Collection: "items"}).Error(), "version conflict in items: document already exists"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+}
+
+func TestRepositoryUpsertReplacement(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+
+	repo := NewRepository[versioned](s, db, "items").WithBehaviors(Behaviors{Timestamps: true, Versioning: true})
+	if err := repo.Upsert(ctx, bson.M{"_id": 1}, versioned{ID: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.M
+	if err := s.Database(db).Collection("items").FindOne(ctx, bson.M{"_id": 1}).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["version"] != int64(1) {
+		t.Errorf("version = %v, want 1", doc["version"])
+	}
+	created, ok := doc["createdAt"].(interface{ Time() time.Time })
+	if !ok || !created.Time().Equal(doc["updatedAt"].(interface{ Time() time.Time }).Time()) {
+		t.Errorf("createdAt = %v, want updatedAt %v", doc["createdAt"], doc["updatedAt"])
+	}
+
+	// Upserting without a version or at a stale one must not overwrite the document
+	if err := repo.Upsert(ctx, bson.M{"_id": 1}, versioned{ID: 1, Name: "b"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Upsert without a version = %v, want ErrConflict", err)
+	}
+	if err := repo.Upsert(ctx, bson.M{"_id": 1}, versioned{ID: 1, Name: "b", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert(ctx, bson.M{"_id": 1}, versioned{ID: 1, Name: "c", Version: 1}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Upsert at a stale version = %v, want ErrConflict", err)
+	}
+	if err := repo.Update(ctx, bson.M{"_id": 1}, versioned{ID: 1, Name: "c"}); !errors.Is(err, ErrNoVersion) {
+		t.Errorf("Update without a version = %v, want ErrNoVersion", err)
+	}
+}
+
+func TestRepositoryReplacementKeepsCreatedAt(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+	c := s.Database(db).Collection("items")
+
+	repo := NewRepository[versioned](s, db, "items").WithBehaviors(Behaviors{Timestamps: true, Versioning: true})
+	if _, err := repo.Insert(ctx, versioned{ID: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	var before bson.M
+	if err := c.FindOne(ctx, bson.M{"_id": 1}).Decode(&before); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := repo.Update(ctx, bson.M{"_id": 1}, versioned{ID: 1, Name: "$b", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert(ctx, bson.M{"_id": 1}, versioned{ID: 1, Name: "c", Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+	var after bson.M
+	if err := c.FindOne(ctx, bson.M{"_id": 1}).Decode(&after); err != nil {
+		t.Fatal(err)
+	}
+	if after["createdAt"] != before["createdAt"] || after["updatedAt"] == before["updatedAt"] {
+		t.Errorf("timestamps after replacements = %v, %v, created at %v", after["createdAt"], after["updatedAt"], before["createdAt"])
+	}
+	if after["name"] != "c" || after["version"] != int64(3) {
+		t.Errorf("document after replacements = %v", after)
+	}
+}
+
+func TestRepositoryUpsertWithoutUniqueIndex(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+
+	type account struct {
+		ID      interface{} `bson:"_id,omitempty"`
+		Email   string      `bson:"email"`
+		Plan    string      `bson:"plan"`
+		Version int64       `bson:"version,omitempty"`
+	}
+	repo := NewRepository[account](s, db, "accounts").WithBehaviors(Behaviors{Versioning: true})
+	selector := bson.M{"email": "a@example.com"}
+	if err := repo.Upsert(ctx, selector, account{Email: "a@example.com", Plan: "free"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert(ctx, selector, account{Email: "a@example.com", Plan: "pro", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// There is no unique index on email, the upserts must not insert a second account
+	if err := repo.Upsert(ctx, selector, account{Email: "a@example.com", Plan: "team", Version: 1}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Upsert at a stale version = %v, want ErrConflict", err)
+	}
+	if err := repo.Upsert(ctx, selector, account{Email: "a@example.com", Plan: "team"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Upsert without a version = %v, want ErrConflict", err)
+	}
+	stale := bson.M{"email": "a@example.com", "version": 1}
+	if err := repo.Upsert(ctx, stale, bson.M{"$set": bson.M{"plan": "team"}}); !errors.Is(err, ErrConflict) {
+		t.Errorf("operator Upsert at a stale version = %v, want ErrConflict", err)
+	}
+	accounts, err := repo.Find(ctx, selector, FindOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Plan != "pro" || accounts[0].Version != 2 {
+		t.Errorf("accounts = %+v, want the pro account at version 2", accounts)
+	}
+
+	if err := repo.Upsert(ctx, bson.M{"email": "b@example.com"}, account{Email: "b@example.com", Plan: "free"}); err != nil {
+		t.Errorf("Upsert of a new account = %v", err)
+	}
+}
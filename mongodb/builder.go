@@ -0,0 +1,348 @@
+package mongodb
+
+import (
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// FilterBuilder - Builds query filters without spelling operators by hand, e.g.
+//
+//	mongodb.Filter().Eq("status", "active").In("tier", "gold", "silver").Gt("age", 18).Build()
+//
+// Conditions on the same field are combined, e.g. Gte("age", 18).Lt("age", 65).
+type FilterBuilder struct {
+	fields []string          // field order of first use
+	ops    map[string]bson.M // operators by field
+	clause []map[string]interface{}
+}
+
+// Filter - Starts a filter, an empty filter matches every document
+func Filter() *FilterBuilder {
+	return &FilterBuilder{ops: map[string]bson.M{}}
+}
+
+func (f *FilterBuilder) op(field, op string, value interface{}) *FilterBuilder {
+	ops, ok := f.ops[field]
+	if !ok {
+		ops = bson.M{}
+		f.ops[field] = ops
+		f.fields = append(f.fields, field)
+	}
+	ops[op] = value
+	return f
+}
+
+// Eq - field equals value
+func (f *FilterBuilder) Eq(field string, value interface{}) *FilterBuilder {
+	return f.op(field, "$eq", value)
+}
+
+// Ne - field does not equal value
+func (f *FilterBuilder) Ne(field string, value interface{}) *FilterBuilder {
+	return f.op(field, "$ne", value)
+}
+
+// Gt - field is greater than value
+func (f *FilterBuilder) Gt(field string, value interface{}) *FilterBuilder {
+	return f.op(field, "$gt", value)
+}
+
+// Gte - field is greater than or equal to value
+func (f *FilterBuilder) Gte(field string, value interface{}) *FilterBuilder {
+	return f.op(field, "$gte", value)
+}
+
+// Lt - field is less than value
+func (f *FilterBuilder) Lt(field string, value interface{}) *FilterBuilder {
+	return f.op(field, "$lt", value)
+}
+
+// Lte - field is less than or equal to value
+func (f *FilterBuilder) Lte(field string, value interface{}) *FilterBuilder {
+	return f.op(field, "$lte", value)
+}
+
+// In - field equals one of values
+func (f *FilterBuilder) In(field string, values ...interface{}) *FilterBuilder {
+	return f.op(field, "$in", bson.A(values))
+}
+
+// Nin - field equals none of values
+func (f *FilterBuilder) Nin(field string, values ...interface{}) *FilterBuilder {
+	return f.op(field, "$nin", bson.A(values))
+}
+
+// Exists - field is present, or absent when exists is false
+func (f *FilterBuilder) Exists(field string, exists bool) *FilterBuilder {
+	return f.op(field, "$exists", exists)
+}
+
+// Regex - field matches pattern with options such as "i"
+func (f *FilterBuilder) Regex(field, pattern, options string) *FilterBuilder {
+	f.op(field, "$regex", pattern)
+	if options != "" {
+		f.op(field, "$options", options)
+	}
+	return f
+}
+
+// Size - array field has n elements
+func (f *FilterBuilder) Size(field string, n int) *FilterBuilder {
+	return f.op(field, "$size", n)
+}
+
+// All - array field contains every value
+func (f *FilterBuilder) All(field string, values ...interface{}) *FilterBuilder {
+	return f.op(field, "$all", bson.A(values))
+}
+
+// ElemMatch - array field has an element matching filter
+func (f *FilterBuilder) ElemMatch(field string, filter map[string]interface{}) *FilterBuilder {
+	return f.op(field, "$elemMatch", filter)
+}
+
+// Or - At least one of filters matches
+func (f *FilterBuilder) Or(filters ...map[string]interface{}) *FilterBuilder {
+	f.clause = append(f.clause, bson.M{"$or": filterList(filters)})
+	return f
+}
+
+// Nor - None of filters matches
+func (f *FilterBuilder) Nor(filters ...map[string]interface{}) *FilterBuilder {
+	f.clause = append(f.clause, bson.M{"$nor": filterList(filters)})
+	return f
+}
+
+// And - Every filter matches, e.g. to combine several Or
+func (f *FilterBuilder) And(filters ...map[string]interface{}) *FilterBuilder {
+	f.clause = append(f.clause, filters...)
+	return f
+}
+
+// Text - Full text search on the text index of the collection
+func (f *FilterBuilder) Text(search string) *FilterBuilder {
+	f.clause = append(f.clause, bson.M{"$text": bson.M{"$search": search}})
+	return f
+}
+
+func filterList(filters []map[string]interface{}) bson.A {
+	list := make(bson.A, len(filters))
+	for i, filter := range filters {
+		list[i] = filter
+	}
+	return list
+}
+
+// Build - Returns the filter, usable wherever the package takes a query or selector
+func (f *FilterBuilder) Build() bson.M {
+	filter := bson.M{}
+	for _, field := range f.fields {
+		ops := f.ops[field]
+		if eq, ok := ops["$eq"]; ok && len(ops) == 1 {
+			filter[field] = eq
+			continue
+		}
+		filter[field] = ops
+	}
+
+	switch len(f.clause) {
+	case 0:
+	case 1:
+		for k := range f.clause[0] {
+			if _, ok := filter[k]; ok {
+				// Keep both conditions on the same key
+				return bson.M{"$and": bson.A{filter, f.clause[0]}}
+			}
+		}
+		for k, v := range f.clause[0] {
+			filter[k] = v
+		}
+	default:
+		filter["$and"] = filterList(f.clause)
+	}
+	return filter
+}
+
+// UpdateBuilder - Builds update documents, e.g.
+//
+//	mongodb.UpdateDoc().Set("status", "shipped").Inc("version", 1).Push("history", entry).Build()
+type UpdateBuilder struct {
+	ops bson.M
+}
+
+// UpdateDoc - Starts an update document, named so because the package already has an Update function
+func UpdateDoc() *UpdateBuilder {
+	return &UpdateBuilder{ops: bson.M{}}
+}
+
+func (u *UpdateBuilder) op(op, field string, value interface{}) *UpdateBuilder {
+	fields, ok := u.ops[op].(bson.M)
+	if !ok {
+		fields = bson.M{}
+		u.ops[op] = fields
+	}
+	fields[field] = value
+	return u
+}
+
+// Set - Sets field to value
+func (u *UpdateBuilder) Set(field string, value interface{}) *UpdateBuilder {
+	return u.op("$set", field, value)
+}
+
+// SetOnInsert - Sets field to value only when an upsert inserts the document
+func (u *UpdateBuilder) SetOnInsert(field string, value interface{}) *UpdateBuilder {
+	return u.op("$setOnInsert", field, value)
+}
+
+// Unset - Removes field
+func (u *UpdateBuilder) Unset(field string) *UpdateBuilder {
+	return u.op("$unset", field, "")
+}
+
+// Inc - Increments field by n
+func (u *UpdateBuilder) Inc(field string, n interface{}) *UpdateBuilder {
+	return u.op("$inc", field, n)
+}
+
+// Mul - Multiplies field by n
+func (u *UpdateBuilder) Mul(field string, n interface{}) *UpdateBuilder {
+	return u.op("$mul", field, n)
+}
+
+// Min - Sets field to value if value is lower
+func (u *UpdateBuilder) Min(field string, value interface{}) *UpdateBuilder {
+	return u.op("$min", field, value)
+}
+
+// Max - Sets field to value if value is greater
+func (u *UpdateBuilder) Max(field string, value interface{}) *UpdateBuilder {
+	return u.op("$max", field, value)
+}
+
+// Rename - Renames field to name
+func (u *UpdateBuilder) Rename(field, name string) *UpdateBuilder {
+	return u.op("$rename", field, name)
+}
+
+// CurrentDate - Sets field to the current date
+func (u *UpdateBuilder) CurrentDate(field string) *UpdateBuilder {
+	return u.op("$currentDate", field, true)
+}
+
+// Push - Appends values to the array field
+func (u *UpdateBuilder) Push(field string, values ...interface{}) *UpdateBuilder {
+	if len(values) == 1 {
+		return u.op("$push", field, values[0])
+	}
+	return u.op("$push", field, bson.M{"$each": bson.A(values)})
+}
+
+// AddToSet - Appends values missing from the array field
+func (u *UpdateBuilder) AddToSet(field string, values ...interface{}) *UpdateBuilder {
+	if len(values) == 1 {
+		return u.op("$addToSet", field, values[0])
+	}
+	return u.op("$addToSet", field, bson.M{"$each": bson.A(values)})
+}
+
+// Pull - Removes the elements of the array field equal to value or matching a condition
+func (u *UpdateBuilder) Pull(field string, value interface{}) *UpdateBuilder {
+	return u.op("$pull", field, value)
+}
+
+// PullAll - Removes the elements of the array field equal to any of values
+func (u *UpdateBuilder) PullAll(field string, values ...interface{}) *UpdateBuilder {
+	return u.op("$pullAll", field, bson.A(values))
+}
+
+// Build - Returns the update document, usable wherever the package takes an updator
+func (u *UpdateBuilder) Build() bson.M {
+	return u.ops
+}
+
+// PipelineBuilder - Builds aggregation pipelines for PipeOne, PipeAll and Aggregate, e.g.
+//
+//	mongodb.Pipeline().Match(mongodb.Filter().Eq("status", "paid").Build()).
+//		Group("$customer", bson.M{"total": bson.M{"$sum": "$amount"}}).Sort("-total").Limit(10).Build()
+type PipelineBuilder struct {
+	stages []bson.M
+}
+
+// Pipeline - Starts an aggregation pipeline
+func Pipeline() *PipelineBuilder {
+	return &PipelineBuilder{}
+}
+
+// Stage - Appends any stage, e.g. Stage("$sample", bson.M{"size": 5})
+func (p *PipelineBuilder) Stage(name string, value interface{}) *PipelineBuilder {
+	p.stages = append(p.stages, bson.M{name: value})
+	return p
+}
+
+// Match - Keeps the documents matching filter
+func (p *PipelineBuilder) Match(filter map[string]interface{}) *PipelineBuilder {
+	return p.Stage("$match", filter)
+}
+
+// Project - Reshapes the documents
+func (p *PipelineBuilder) Project(projection map[string]interface{}) *PipelineBuilder {
+	return p.Stage("$project", projection)
+}
+
+// AddFields - Adds computed fields
+func (p *PipelineBuilder) AddFields(fields map[string]interface{}) *PipelineBuilder {
+	return p.Stage("$addFields", fields)
+}
+
+// Group - Groups by id, e.g. "$customer", computing accumulator fields
+func (p *PipelineBuilder) Group(id interface{}, fields map[string]interface{}) *PipelineBuilder {
+	group := bson.M{"_id": id}
+	for k, v := range fields {
+		group[k] = v
+	}
+	return p.Stage("$group", group)
+}
+
+// Sort - Sorts with mgo style sort parameters, e.g. "-created,name", no stage is added for empty parameters
+func (p *PipelineBuilder) Sort(sortParameters string) *PipelineBuilder {
+	sort := sortDoc(sortParameters)
+	if len(sort) == 0 {
+		return p
+	}
+	return p.Stage("$sort", sort)
+}
+
+// Skip - Skips n documents
+func (p *PipelineBuilder) Skip(n int64) *PipelineBuilder {
+	return p.Stage("$skip", n)
+}
+
+// Limit - Keeps the first n documents
+func (p *PipelineBuilder) Limit(n int64) *PipelineBuilder {
+	return p.Stage("$limit", n)
+}
+
+// Unwind - Outputs one document per element of the array at path, e.g. "$items"
+func (p *PipelineBuilder) Unwind(path string) *PipelineBuilder {
+	return p.Stage("$unwind", path)
+}
+
+// Lookup - Joins the documents of collection from where foreignField equals localField into as
+func (p *PipelineBuilder) Lookup(from, localField, foreignField, as string) *PipelineBuilder {
+	return p.Stage("$lookup", bson.M{
+		"from":         from,
+		"localField":   localField,
+		"foreignField": foreignField,
+		"as":           as,
+	})
+}
+
+// Count - Outputs one document with the number of documents in field
+func (p *PipelineBuilder) Count(field string) *PipelineBuilder {
+	return p.Stage("$count", field)
+}
+
+// Build - Returns the pipeline
+func (p *PipelineBuilder) Build() []bson.M {
+	return p.stages
+}
@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// sameBSON - Compares the documents as encoded, so that map types and key order don't matter
+func sameBSON(t *testing.T, got, want interface{}) bool {
+	t.Helper()
+	decode := func(v interface{}) bson.M {
+		data, err := bson.Marshal(bson.M{"v": v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc bson.M
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	return reflect.DeepEqual(decode(got), decode(want))
+}
+
+func TestFilterBuilder(t *testing.T) {
+	tests := []struct {
+		name string
+		got  bson.M
+		want bson.M
+	}{
+		{"empty", Filter().Build(), bson.M{}},
+		{"eq collapses", Filter().Eq("status", "active").Build(), bson.M{"status": "active"}},
+		{"eq with other operators",
+			Filter().Eq("n", 1).Ne("n", 2).Build(),
+			bson.M{"n": bson.M{"$eq": 1, "$ne": 2}}},
+		{"operators on one field",
+			Filter().Gte("age", 18).Lt("age", 65).In("tier", "gold", "silver").Build(),
+			bson.M{"age": bson.M{"$gte": 18, "$lt": 65}, "tier": bson.M{"$in": bson.A{"gold", "silver"}}}},
+		{"regex", Filter().Regex("name", "^a", "i").Build(),
+			bson.M{"name": bson.M{"$regex": "^a", "$options": "i"}}},
+		{"single clause",
+			Filter().Eq("status", "active").Or(bson.M{"a": 1}, bson.M{"b": 2}).Build(),
+			bson.M{"status": "active", "$or": bson.A{bson.M{"a": 1}, bson.M{"b": 2}}}},
+		{"single clause on a field key",
+			Filter().Gt("age", 18).And(bson.M{"age": bson.M{"$lt": 65}}).Build(),
+			bson.M{"$and": bson.A{bson.M{"age": bson.M{"$gt": 18}}, bson.M{"age": bson.M{"$lt": 65}}}}},
+		{"several or",
+			Filter().Eq("status", "active").Or(bson.M{"a": 1}, bson.M{"b": 2}).Or(bson.M{"c": 3}, bson.M{"d": 4}).Build(),
+			bson.M{"status": "active", "$and": bson.A{
+				bson.M{"$or": bson.A{bson.M{"a": 1}, bson.M{"b": 2}}},
+				bson.M{"$or": bson.A{bson.M{"c": 3}, bson.M{"d": 4}}},
+			}}},
+		{"text", Filter().Text("coffee").Build(), bson.M{"$text": bson.M{"$search": "coffee"}}},
+	}
+	for _, tt := range tests {
+		if !sameBSON(t, tt.got, tt.want) {
+			t.Errorf("%s: Build = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestUpdateBuilder(t *testing.T) {
+	got := UpdateDoc().
+		Set("status", "shipped").Set("by", "bob").
+		Inc("version", 1).
+		Unset("draft").
+		Push("history", "a").Push("tags", "x", "y").
+		AddToSet("labels", "l").AddToSet("owners", "o1", "o2").
+		Build()
+	want := bson.M{
+		"$set":      bson.M{"status": "shipped", "by": "bob"},
+		"$inc":      bson.M{"version": 1},
+		"$unset":    bson.M{"draft": ""},
+		"$push":     bson.M{"history": "a", "tags": bson.M{"$each": bson.A{"x", "y"}}},
+		"$addToSet": bson.M{"labels": "l", "owners": bson.M{"$each": bson.A{"o1", "o2"}}},
+	}
+	if !sameBSON(t, got, want) {
+		t.Errorf("Build = %v, want %v", got, want)
+	}
+}
+
+func TestPipelineBuilder(t *testing.T) {
+	got := Pipeline().
+		Match(bson.M{"status": "paid"}).
+		Group("$customer", bson.M{"total": bson.M{"$sum": "$amount"}}).
+		Sort("-total").
+		Sort("").
+		Skip(10).
+		Limit(5).
+		Build()
+	want := []bson.M{
+		{"$match": bson.M{"status": "paid"}},
+		{"$group": bson.M{"_id": "$customer", "total": bson.M{"$sum": "$amount"}}},
+		{"$sort": bson.D{{Key: "total", Value: -1}}},
+		{"$skip": int64(10)},
+		{"$limit": int64(5)},
+	}
+	if !sameBSON(t, got, want) {
+		t.Errorf("Build = %v, want %v", got, want)
+	}
+
+	// The decoded comparison ignores key order, which matters for sorts
+	sort := Pipeline().Sort("-created, name").Build()[0]["$sort"]
+	if want := (bson.D{{Key: "created", Value: -1}, {Key: "name", Value: 1}}); !reflect.DeepEqual(sort, want) {
+		t.Errorf("$sort = %v, want %v", sort, want)
+	}
+}
@@ -0,0 +1,292 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultBulkBatchSize - Operations per bulk write when BulkOptions.BatchSize is not set
+const DefaultBulkBatchSize = 1000
+
+// BulkOptions - Configuration of a BulkWriter
+type BulkOptions struct {
+	BatchSize int // operations queued before a flush, default DefaultBulkBatchSize
+	// FlushInterval flushes queued operations in the background, 0 only flushes on size and Close
+	FlushInterval time.Duration
+	// Ordered stops a batch at the first failing operation, unordered batches run every operation
+	Ordered bool
+}
+
+// BulkError - Failure of one operation, Index counts every operation queued on the writer from 0.
+// Skipped operations were not executed because an earlier operation of their ordered batch failed.
+type BulkError struct {
+	Index   int
+	Code    int
+	Message string
+	Skipped bool
+}
+
+func (e BulkError) Error() string {
+	if e.Skipped {
+		return "operation " + strconv.Itoa(e.Index) + " skipped: " + e.Message
+	}
+	return "operation " + strconv.Itoa(e.Index) + " failed: " + e.Message
+}
+
+// BatchError - Failure of a whole batch, e.g. a network error or a timeout, returned by Flush.
+// The operations First to First+Count-1 may or may not have been applied and are also listed in BulkResult.Errors.
+type BatchError struct {
+	First int
+	Count int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("bulk write of operations %d to %d failed: %v", e.First, e.First+e.Count-1, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BulkResult - Totals of the operations flushed by a BulkWriter
+type BulkResult struct {
+	Inserted    int64
+	Matched     int64
+	Modified    int64
+	Upserted    int64
+	Deleted     int64
+	UpsertedIDs map[int]interface{} // _id of upserted documents by operation index
+	Errors      []BulkError
+}
+
+// BulkWriter - Batches insert, update, upsert and delete operations on one collection into bulk writes.
+// Per operation failures are collected in the result, errors returned by the methods are failures of a whole batch.
+type BulkWriter struct {
+	coll *mongo.Collection
+	opts BulkOptions
+
+	mu      sync.Mutex
+	models  []mongo.WriteModel
+	queued  int // operations queued so far, the index of the next one
+	result  BulkResult
+	lastErr error // errors of the background flushes not returned yet
+
+	flushMu sync.Mutex // serializes batches so ordered mode holds across them
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewBulkWriter - Creates a bulk writer for a collection, Close must be called to flush the last batch
+func NewBulkWriter(s Session, dbname string, collection string, opts BulkOptions) *BulkWriter {
+	return newBulkWriter(s.Database(dbname).Collection(collection), opts)
+}
+
+// BulkWriter - Creates a bulk writer for the collection of r, writes bypass the Behaviors of r
+func (r *Repository[T]) BulkWriter(opts BulkOptions) *BulkWriter {
+	return newBulkWriter(r.collection(), opts)
+}
+
+func newBulkWriter(c *mongo.Collection, opts BulkOptions) *BulkWriter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBulkBatchSize
+	}
+	w := &BulkWriter{
+		coll:   c,
+		opts:   opts,
+		result: BulkResult{UpsertedIDs: map[int]interface{}{}},
+	}
+	if opts.FlushInterval > 0 {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.flushLoop()
+	}
+	return w
+}
+
+func (w *BulkWriter) flushLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.Flush(context.Background()); err != nil {
+				w.mu.Lock()
+				w.lastErr = errors.Join(w.lastErr, err)
+				w.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Insert - Queues the insertion of object
+func (w *BulkWriter) Insert(ctx context.Context, object interface{}) error {
+	return w.add(ctx, mongo.NewInsertOneModel().SetDocument(object))
+}
+
+// Update - Queues the update of the first document matching selector with an update document or a replacement
+func (w *BulkWriter) Update(ctx context.Context, selector map[string]interface{}, update interface{}) error {
+	return w.add(ctx, updateModel(selector, update, false))
+}
+
+// UpdateAll - Queues the update of every document matching selector
+func (w *BulkWriter) UpdateAll(ctx context.Context, selector map[string]interface{}, update interface{}) error {
+	return w.add(ctx, mongo.NewUpdateManyModel().SetFilter(filterOf(selector)).SetUpdate(update))
+}
+
+// Upsert - Queues the update of the first document matching selector, inserting it if there is none
+func (w *BulkWriter) Upsert(ctx context.Context, selector map[string]interface{}, update interface{}) error {
+	return w.add(ctx, updateModel(selector, update, true))
+}
+
+// Delete - Queues the deletion of the first document matching selector
+func (w *BulkWriter) Delete(ctx context.Context, selector map[string]interface{}) error {
+	return w.add(ctx, mongo.NewDeleteOneModel().SetFilter(filterOf(selector)))
+}
+
+// DeleteAll - Queues the deletion of every document matching selector
+func (w *BulkWriter) DeleteAll(ctx context.Context, selector map[string]interface{}) error {
+	return w.add(ctx, mongo.NewDeleteManyModel().SetFilter(filterOf(selector)))
+}
+
+func updateModel(selector map[string]interface{}, update interface{}, upsert bool) mongo.WriteModel {
+	if isOperatorDoc(update) {
+		return mongo.NewUpdateOneModel().SetFilter(filterOf(selector)).SetUpdate(update).SetUpsert(upsert)
+	}
+	return mongo.NewReplaceOneModel().SetFilter(filterOf(selector)).SetReplacement(update).SetUpsert(upsert)
+}
+
+// add - Queues an operation and flushes once the batch is full.
+// The errors of previous background flushes are returned first.
+func (w *BulkWriter) add(ctx context.Context, model mongo.WriteModel) error {
+	w.mu.Lock()
+	if err := w.lastErr; err != nil {
+		w.lastErr = nil
+		w.mu.Unlock()
+		return err
+	}
+	w.models = append(w.models, model)
+	w.queued++
+	full := len(w.models) >= w.opts.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush - Writes the queued operations, a *BatchError is returned when the batch fails as a whole
+func (w *BulkWriter) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	models := w.models
+	base := w.queued - len(models)
+	w.models = nil
+	w.mu.Unlock()
+	if len(models) == 0 {
+		return nil
+	}
+
+	res, err := w.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(w.opts.Ordered))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if res != nil {
+		w.result.Inserted += res.InsertedCount
+		w.result.Matched += res.MatchedCount
+		w.result.Modified += res.ModifiedCount
+		w.result.Upserted += res.UpsertedCount
+		w.result.Deleted += res.DeletedCount
+		for i, id := range res.UpsertedIDs {
+			w.result.UpsertedIDs[base+int(i)] = id
+		}
+	}
+
+	w.result.Errors = append(w.result.Errors, batchErrors(base, len(models), w.opts.Ordered, err)...)
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		if bulkErr.WriteConcernError == nil {
+			return nil
+		}
+		return bulkErr.WriteConcernError
+	}
+	if err != nil {
+		return &BatchError{First: base, Count: len(models), Err: err}
+	}
+	return nil
+}
+
+// batchErrors - Returns the failed operations of a batch of n operations starting at base
+func batchErrors(base, n int, ordered bool, err error) []BulkError {
+	if err == nil {
+		return nil
+	}
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) {
+		errs := make([]BulkError, n)
+		for i := range errs {
+			errs[i] = BulkError{Index: base + i, Message: "batch failed: " + err.Error()}
+		}
+		return errs
+	}
+
+	var errs []BulkError
+	for _, e := range bulkErr.WriteErrors {
+		errs = append(errs, BulkError{Index: base + e.Index, Code: e.Code, Message: e.Message})
+	}
+	if ordered && len(bulkErr.WriteErrors) > 0 {
+		// The server stops an ordered batch at its first error
+		failed := bulkErr.WriteErrors[0].Index
+		for i := failed + 1; i < n; i++ {
+			errs = append(errs, BulkError{
+				Index:   base + i,
+				Message: "operation " + strconv.Itoa(base+failed) + " failed first",
+				Skipped: true,
+			})
+		}
+	}
+	return errs
+}
+
+// Result - Returns the totals of the operations flushed so far
+func (w *BulkWriter) Result() BulkResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	r := w.result
+	r.UpsertedIDs = make(map[int]interface{}, len(w.result.UpsertedIDs))
+	for i, id := range w.result.UpsertedIDs {
+		r.UpsertedIDs[i] = id
+	}
+	r.Errors = append([]BulkError(nil), w.result.Errors...)
+	return r
+}
+
+// Close - Stops background flushing, writes the remaining operations and returns the totals
+func (w *BulkWriter) Close(ctx context.Context) (BulkResult, error) {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+	err := w.Flush(ctx)
+
+	w.mu.Lock()
+	err = errors.Join(w.lastErr, err)
+	w.lastErr = nil
+	w.mu.Unlock()
+	return w.Result(), err
+}
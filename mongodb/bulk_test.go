@@ -0,0 +1,87 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBatchErrors(t *testing.T) {
+	duplicate := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}},
+	}}
+	tests := []struct {
+		name    string
+		ordered bool
+		err     error
+		want    []BulkError
+	}{
+		{"success", true, nil, nil},
+		{"unordered", false, duplicate, []BulkError{{Index: 11, Code: 11000, Message: "duplicate key"}}},
+		{"ordered", true, duplicate, []BulkError{
+			{Index: 11, Code: 11000, Message: "duplicate key"},
+			{Index: 12, Message: "operation 11 failed first", Skipped: true},
+			{Index: 13, Message: "operation 11 failed first", Skipped: true},
+		}},
+		{"whole batch", false, errors.New("connection reset"), []BulkError{
+			{Index: 10, Message: "batch failed: connection reset"},
+			{Index: 11, Message: "batch failed: connection reset"},
+			{Index: 12, Message: "batch failed: connection reset"},
+			{Index: 13, Message: "batch failed: connection reset"},
+		}},
+	}
+	for _, tt := range tests {
+		if got := batchErrors(10, 4, tt.ordered, tt.err); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: batchErrors = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBulkWriterOrdered(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+
+	w := NewBulkWriter(s, db, "items", BulkOptions{BatchSize: 3, Ordered: true})
+	for _, id := range []int{1, 1, 2, 3} {
+		if err := w.Insert(ctx, bson.M{"_id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := w.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Inserted != 2 {
+		t.Errorf("Inserted = %d, want 2", res.Inserted)
+	}
+	want := []BulkError{{Index: 1, Code: 11000}, {Index: 2, Skipped: true}}
+	if len(res.Errors) != len(want) {
+		t.Fatalf("Errors = %v", res.Errors)
+	}
+	for i, e := range res.Errors {
+		if e.Index != want[i].Index || e.Code != want[i].Code || e.Skipped != want[i].Skipped {
+			t.Errorf("Errors[%d] = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestBulkWriterBatchError(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := NewBulkWriter(s, db, "items", BulkOptions{})
+	w.Insert(ctx, bson.M{"_id": 1})
+	_, err := w.Close(ctx)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.First != 0 || batchErr.Count != 1 {
+		t.Errorf("Close = %v, want a BatchError of operation 0", err)
+	}
+	if res := w.Result(); len(res.Errors) != 1 {
+		t.Errorf("Errors = %v", res.Errors)
+	}
+}
@@ -0,0 +1,272 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrStreamInvalidated - Returned by Watch when the watched collection or database is dropped or renamed
+var ErrStreamInvalidated = errors.New("change stream invalidated")
+
+// ResumeTokenStore - Persists change stream resume tokens so watchers resume after restarts.
+// NewMongoTokenStore and redis.NewResumeTokenStore implement it.
+type ResumeTokenStore interface {
+	// LoadToken returns nil when no token was saved under key
+	LoadToken(ctx context.Context, key string) ([]byte, error)
+	SaveToken(ctx context.Context, key string, token []byte) error
+}
+
+// MongoTokenStore - Keeps resume tokens in a collection
+type MongoTokenStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoTokenStore - Creates a token store in the given collection, default "resume_tokens"
+func NewMongoTokenStore(s Session, dbname string, collection string) *MongoTokenStore {
+	if collection == "" {
+		collection = "resume_tokens"
+	}
+	return &MongoTokenStore{coll: s.Database(dbname).Collection(collection)}
+}
+
+// LoadToken - LoadToken
+func (t *MongoTokenStore) LoadToken(ctx context.Context, key string) ([]byte, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := t.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+// SaveToken - SaveToken
+func (t *MongoTokenStore) SaveToken(ctx context.Context, key string, token []byte) error {
+	update := bson.M{"$set": bson.M{"token": bson.Raw(token), "updatedAt": time.Now().UTC()}}
+	_, err := t.coll.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// UpdateDescription - Fields changed by an update event
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// ChangeEvent - Change stream event
+type ChangeEvent struct {
+	ResumeToken   bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"` // insert, update, replace, delete, drop, rename, invalidate...
+	Namespace     struct {
+		Database   string `bson:"db"`
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey       bson.M              `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument"` // inserts and replaces, and updates with Watcher.FullDocument
+	UpdateDescription *UpdateDescription  `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+
+// Decode - Decodes the full document of the event into v
+func (e ChangeEvent) Decode(v interface{}) error {
+	if e.FullDocument == nil {
+		return ErrNotFound
+	}
+	return bson.Unmarshal(e.FullDocument, v)
+}
+
+// Watcher - Change stream consumer of a collection, or of a database when Collection is empty
+type Watcher struct {
+	Session    Session
+	Database   string
+	Collection string
+	Pipeline   []bson.M // filters such as {"$match": {"operationType": "insert"}}
+	// FullDocument looks up the current document for update events
+	FullDocument bool
+	// Store persists the resume token after every handled event and every empty batch, nil keeps it in memory only
+	Store ResumeTokenStore
+	// Key of the token in Store, default "<database>.<collection>"
+	Key       string
+	BatchSize int32
+	// RetryDelay is the first reconnection delay, doubled up to MaxRetryDelay, defaults 1s and 30s
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+func (w *Watcher) key() string {
+	if w.Key != "" {
+		return w.Key
+	}
+	return w.Database + "." + w.Collection
+}
+
+// Watch - Calls fn for every change until ctx is cancelled or fn returns an error.
+// The stream resumes from the stored token and reconnects after resumable errors, so fn
+// sees every event at least once and may see an event again after a crash.
+// After ErrStreamInvalidated, calling Watch again starts after the invalidate event (MongoDB 4.2+).
+func (w *Watcher) Watch(ctx context.Context, fn func(ChangeEvent) error) error {
+	retryDelay := w.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+	maxRetryDelay := w.MaxRetryDelay
+	if maxRetryDelay <= 0 {
+		maxRetryDelay = 30 * time.Second
+	}
+
+	var token bson.Raw
+	if w.Store != nil {
+		saved, err := w.Store.LoadToken(ctx, w.key())
+		if err != nil {
+			return fmt.Errorf("error loading resume token: %v", err)
+		}
+		token = saved
+	}
+
+	delay := retryDelay
+	for {
+		received, err := w.watch(ctx, &token, fn)
+		if err == nil || ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !isResumable(err) {
+			return err
+		}
+		if received {
+			delay = retryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// watch - Consumes one change stream, keeping token up to date, and reports whether any event was received
+func (w *Watcher) watch(ctx context.Context, token *bson.Raw, fn func(ChangeEvent) error) (bool, error) {
+	opts := options.ChangeStream()
+	if w.FullDocument {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
+	if w.BatchSize > 0 {
+		opts.SetBatchSize(w.BatchSize)
+	}
+	if *token != nil {
+		// Unlike resumeAfter, startAfter also accepts the token of an invalidate event
+		opts.SetStartAfter(*token)
+	}
+	pipeline := w.Pipeline
+	if pipeline == nil {
+		pipeline = []bson.M{}
+	}
+
+	db := w.Session.Database(w.Database)
+	var (
+		cs  *mongo.ChangeStream
+		err error
+	)
+	if w.Collection == "" {
+		cs, err = db.Watch(ctx, pipeline, opts)
+	} else {
+		cs, err = db.Collection(w.Collection).Watch(ctx, pipeline, opts)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer cs.Close(context.Background())
+
+	received := false
+	for {
+		if !cs.TryNext(ctx) {
+			if err := cs.Err(); err != nil {
+				return received, err
+			}
+			if cs.ID() == 0 {
+				// The server closed the stream without an error, reconnect
+				return received, errStreamClosed
+			}
+			// An empty batch still moves the resume token past the events the pipeline filtered out
+			if err := w.saveToken(ctx, token, cs.ResumeToken()); err != nil {
+				return received, err
+			}
+			continue
+		}
+
+		var ev ChangeEvent
+		if err := cs.Decode(&ev); err != nil {
+			return received, &watchError{fmt.Errorf("error decoding change event: %w", err)}
+		}
+		received = true
+		if err := fn(ev); err != nil {
+			return received, &watchError{err}
+		}
+		if err := w.saveToken(ctx, token, cs.ResumeToken()); err != nil {
+			return received, err
+		}
+		if ev.OperationType == "invalidate" {
+			return received, &watchError{ErrStreamInvalidated}
+		}
+	}
+}
+
+// saveToken - Keeps the latest resume token and persists it when it changed
+func (w *Watcher) saveToken(ctx context.Context, token *bson.Raw, latest bson.Raw) error {
+	if latest == nil || bytes.Equal(*token, latest) {
+		return nil
+	}
+	*token = append(bson.Raw(nil), latest...)
+	if w.Store == nil {
+		return nil
+	}
+	if err := w.Store.SaveToken(ctx, w.key(), *token); err != nil {
+		return &watchError{fmt.Errorf("error saving resume token: %w", err)}
+	}
+	return nil
+}
+
+var errStreamClosed = errors.New("change stream closed")
+
+// watchError - Error that must stop Watch, returned unwrapped
+type watchError struct{ err error }
+
+func (e *watchError) Error() string { return e.err.Error() }
+
+func (e *watchError) Unwrap() error { return e.err }
+
+// isResumable - Reports whether the stream may be reopened after err.
+// Server errors are resumable only with the ResumableChangeStreamError label,
+// network and server selection failures always are.
+func isResumable(err error) bool {
+	var stop *watchError
+	if errors.As(err, &stop) {
+		return false
+	}
+	if err == errStreamClosed || mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	if errors.Is(err, mongo.ErrClientDisconnected) {
+		return false
+	}
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorLabel("ResumableChangeStreamError")
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+type memoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string][]byte
+	saves  int
+}
+
+func (m *memoryTokenStore) LoadToken(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[key], nil
+}
+
+func (m *memoryTokenStore) SaveToken(ctx context.Context, key string, token []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = map[string][]byte{}
+	}
+	m.tokens[key] = token
+	m.saves++
+	return nil
+}
+
+func (m *memoryTokenStore) saved() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saves
+}
+
+// The change stream tests need MONGO_URI to point to a replica set
+func TestWatcherSavesTokenOfFilteredBatches(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store := &memoryTokenStore{}
+	w := &Watcher{
+		Session:    s,
+		Database:   db,
+		Collection: "items",
+		Pipeline:   []bson.M{{"$match": bson.M{"fullDocument.kind": "wanted"}}},
+		Store:      store,
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Watch(ctx, func(ev ChangeEvent) error {
+			return errors.New("unexpected event")
+		})
+	}()
+
+	for i := 0; store.saved() == 0 && ctx.Err() == nil; i++ {
+		if err := Insert(ctx, s, db, "items", bson.M{"kind": "other", "n": i}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch = %v", err)
+	}
+	if store.saved() == 0 {
+		t.Error("no resume token saved for batches without matching events")
+	}
+}
+
+func TestWatcherStartsAfterInvalidate(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	store := &memoryTokenStore{}
+	w := &Watcher{Session: s, Database: db, Collection: "items", Store: store}
+	if err := Insert(ctx, s, db, "items", bson.M{"n": 0}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(ctx, func(ChangeEvent) error { return nil }) }()
+	time.Sleep(500 * time.Millisecond)
+	if err := s.Database(db).Collection("items").Drop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrStreamInvalidated) {
+		t.Fatalf("Watch = %v, want ErrStreamInvalidated", err)
+	}
+
+	// Watching again starts after the stored invalidate token
+	events := make(chan ChangeEvent, 1)
+	go func() {
+		done <- w.Watch(ctx, func(ev ChangeEvent) error {
+			events <- ev
+			return errors.New("stop")
+		})
+	}()
+	time.Sleep(500 * time.Millisecond)
+	if err := Insert(ctx, s, db, "items", bson.M{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.OperationType != "insert" {
+			t.Errorf("event = %s, want insert", ev.OperationType)
+		}
+	case err := <-done:
+		t.Fatalf("Watch after invalidate = %v", err)
+	}
+}
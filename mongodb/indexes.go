@@ -0,0 +1,281 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec - Declarative index of a collection
+type IndexSpec struct {
+	// Keys in index order, values are 1, -1, "text", "2dsphere" or "hashed", e.g.
+	// bson.D{{Key: "tenant", Value: 1}, {Key: "created", Value: -1}}
+	Keys bson.D
+	// Name defaults to the server convention, e.g. "tenant_1_created_-1"
+	Name   string
+	Unique bool
+	Sparse bool
+	// TTL removes documents once the date in the single key field is older, zero disables it
+	TTL time.Duration
+	// PartialFilter only indexes documents matching the filter
+	PartialFilter map[string]interface{}
+	// Weights and DefaultLanguage of text indexes
+	Weights         map[string]int
+	DefaultLanguage string
+}
+
+// Schema - Index specs by collection name
+type Schema map[string][]IndexSpec
+
+// EnsureOptions - Options of EnsureIndexes
+type EnsureOptions struct {
+	DropStale bool // drop indexes that are not declared, _id_ is always kept
+	DryRun    bool // only report the changes
+}
+
+// Index change actions
+const (
+	IndexCreated   = "created"
+	IndexRecreated = "recreated" // the definition changed, the index was dropped and created again
+	IndexDropped   = "dropped"
+	IndexStale     = "stale" // exists but is not declared, kept without DropStale
+)
+
+// IndexChange - Change applied, or to apply with DryRun, by EnsureIndexes
+type IndexChange struct {
+	Collection string
+	Name       string
+	Action     string
+}
+
+func (c IndexChange) String() string {
+	return c.Collection + "." + c.Name + " " + c.Action
+}
+
+// IndexName - Returns the name of the index, following the server naming convention when Name is empty
+func (spec IndexSpec) IndexName() string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	parts := make([]string, 0, len(spec.Keys))
+	for _, e := range spec.Keys {
+		parts = append(parts, e.Key+"_"+fmt.Sprint(e.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (spec IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(spec.IndexName())
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.Sparse {
+		opts.SetSparse(true)
+	}
+	if spec.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(spec.TTL / time.Second))
+	}
+	if spec.PartialFilter != nil {
+		opts.SetPartialFilterExpression(spec.PartialFilter)
+	}
+	if spec.Weights != nil {
+		opts.SetWeights(spec.Weights)
+	}
+	if spec.DefaultLanguage != "" {
+		opts.SetDefaultLanguage(spec.DefaultLanguage)
+	}
+	return mongo.IndexModel{Keys: spec.Keys, Options: opts}
+}
+
+func (spec IndexSpec) isText() bool {
+	for _, e := range spec.Keys {
+		if e.Value == "text" {
+			return true
+		}
+	}
+	return false
+}
+
+// textWeights - Returns the weights the server stores for a text index, text fields default to 1
+func (spec IndexSpec) textWeights() map[string]int64 {
+	weights := make(map[string]int64, len(spec.Keys)+len(spec.Weights))
+	for _, e := range spec.Keys {
+		if e.Value == "text" {
+			weights[e.Key] = 1
+		}
+	}
+	for field, w := range spec.Weights {
+		weights[field] = int64(w)
+	}
+	return weights
+}
+
+// existingIndex - Index definition as listed by the server
+type existingIndex struct {
+	Name                    string   `bson:"name"`
+	Key                     bson.D   `bson:"key"`
+	Unique                  bool     `bson:"unique"`
+	Sparse                  bool     `bson:"sparse"`
+	ExpireAfterSeconds      *int32   `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.Raw `bson:"partialFilterExpression"`
+	DefaultLanguage         string   `bson:"default_language"`
+	Weights                 bson.M   `bson:"weights"`
+}
+
+// matches - Reports whether the existing index has the definition of spec
+func (e existingIndex) matches(spec IndexSpec) (bool, error) {
+	// Text indexes are stored with internal keys, their fields are compared through the weights
+	if !spec.isText() {
+		if len(e.Key) != len(spec.Keys) {
+			return false, nil
+		}
+		for i, k := range spec.Keys {
+			if e.Key[i].Key != k.Key || fmt.Sprint(e.Key[i].Value) != fmt.Sprint(k.Value) {
+				return false, nil
+			}
+		}
+	} else {
+		if spec.DefaultLanguage != "" && e.DefaultLanguage != spec.DefaultLanguage {
+			return false, nil
+		}
+		weights := spec.textWeights()
+		if len(e.Weights) != len(weights) {
+			return false, nil
+		}
+		for field, w := range e.Weights {
+			if n, ok := toInt64(w); !ok || n != weights[field] {
+				return false, nil
+			}
+		}
+	}
+	if e.Unique != spec.Unique || e.Sparse != spec.Sparse {
+		return false, nil
+	}
+
+	ttl := int32(spec.TTL / time.Second)
+	if (e.ExpireAfterSeconds == nil) != (spec.TTL <= 0) || (e.ExpireAfterSeconds != nil && *e.ExpireAfterSeconds != ttl) {
+		return false, nil
+	}
+
+	if (e.PartialFilterExpression == nil) != (spec.PartialFilter == nil) {
+		return false, nil
+	}
+	if spec.PartialFilter != nil {
+		// Round trip the declared filter so both sides have the same bson types
+		data, err := bson.Marshal(spec.PartialFilter)
+		if err != nil {
+			return false, err
+		}
+		var declared, existing bson.M
+		if err := bson.Unmarshal(data, &declared); err != nil {
+			return false, err
+		}
+		if err := bson.Unmarshal(e.PartialFilterExpression, &existing); err != nil {
+			return false, err
+		}
+		if !reflect.DeepEqual(declared, existing) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// EnsureIndexes - Creates the declared indexes missing from each collection, recreates those whose
+// definition changed and drops, with DropStale, those not declared. Run it at startup after Init.
+// A changed index is missing while it is rebuilt, the error of a failed rebuild names the dropped index.
+func EnsureIndexes(ctx context.Context, s Session, dbname string, schema Schema, opts EnsureOptions) ([]IndexChange, error) {
+	collections := make([]string, 0, len(schema))
+	for name := range schema {
+		collections = append(collections, name)
+	}
+	sort.Strings(collections)
+
+	var changes []IndexChange
+	for _, name := range collections {
+		c, err := ensureCollectionIndexes(ctx, s.Database(dbname).Collection(name), schema[name], opts)
+		changes = append(changes, c...)
+		if err != nil {
+			return changes, fmt.Errorf("error ensuring indexes of %s: %v", name, err)
+		}
+	}
+	return changes, nil
+}
+
+func ensureCollectionIndexes(ctx context.Context, c *mongo.Collection, specs []IndexSpec, opts EnsureOptions) ([]IndexChange, error) {
+	cur, err := c.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []existingIndex
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	existing := make(map[string]existingIndex, len(list))
+	for _, idx := range list {
+		existing[idx.Name] = idx
+	}
+
+	var changes []IndexChange
+	change := func(name, action string) {
+		changes = append(changes, IndexChange{Collection: c.Name(), Name: name, Action: action})
+	}
+
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		name := spec.IndexName()
+		declared[name] = true
+
+		action := IndexCreated
+		if idx, ok := existing[name]; ok {
+			same, err := idx.matches(spec)
+			if err != nil {
+				return changes, err
+			}
+			if same {
+				continue
+			}
+			action = IndexRecreated
+			if !opts.DryRun {
+				if _, err := c.Indexes().DropOne(ctx, name); err != nil {
+					return changes, err
+				}
+			}
+		}
+		if !opts.DryRun {
+			if _, err := c.Indexes().CreateOne(ctx, spec.model()); err != nil {
+				if action == IndexRecreated {
+					// The server neither renames indexes nor keeps two with the same keys, so the
+					// old definition could not be kept until the new one was built
+					change(name, IndexDropped)
+					return changes, fmt.Errorf("index %s was dropped to be recreated but creating it failed: %v", name, err)
+				}
+				return changes, err
+			}
+		}
+		change(name, action)
+	}
+
+	for _, idx := range list {
+		if idx.Name == "_id_" || declared[idx.Name] {
+			continue
+		}
+		if !opts.DropStale {
+			change(idx.Name, IndexStale)
+			continue
+		}
+		if !opts.DryRun {
+			if _, err := c.Indexes().DropOne(ctx, idx.Name); err != nil {
+				return changes, err
+			}
+		}
+		change(idx.Name, IndexDropped)
+	}
+	return changes, nil
+}
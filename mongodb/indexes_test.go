@@ -0,0 +1,79 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexMatches(t *testing.T) {
+	ttl := int32(3600)
+	text := existingIndex{
+		Name:            "search",
+		Key:             bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+		DefaultLanguage: "english",
+		Weights:         bson.M{"title": int32(10), "body": int32(1)},
+	}
+	tests := []struct {
+		name     string
+		existing existingIndex
+		spec     IndexSpec
+		want     bool
+	}{
+		{"same keys", existingIndex{Key: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(-1)}}},
+			IndexSpec{Keys: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1}}}, true},
+		{"key order", existingIndex{Key: bson.D{{Key: "a", Value: int32(1)}}},
+			IndexSpec{Keys: bson.D{{Key: "a", Value: -1}}}, false},
+		{"unique", existingIndex{Key: bson.D{{Key: "a", Value: int32(1)}}},
+			IndexSpec{Keys: bson.D{{Key: "a", Value: 1}}, Unique: true}, false},
+		{"ttl", existingIndex{Key: bson.D{{Key: "at", Value: int32(1)}}, ExpireAfterSeconds: &ttl},
+			IndexSpec{Keys: bson.D{{Key: "at", Value: 1}}, TTL: 2 * time.Hour}, false},
+		{"text weights", text,
+			IndexSpec{Name: "search", Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}, Weights: map[string]int{"title": 10}}, true},
+		{"text weight changed", text,
+			IndexSpec{Name: "search", Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}, Weights: map[string]int{"title": 5}}, false},
+		{"text field added", text,
+			IndexSpec{Name: "search", Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}, {Key: "tags", Value: "text"}}, Weights: map[string]int{"title": 10}}, false},
+	}
+	for _, tt := range tests {
+		got, err := tt.existing.matches(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+
+	schema := Schema{"items": {
+		{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "created", Value: -1}}},
+		{Name: "search", Keys: bson.D{{Key: "title", Value: "text"}}, Weights: map[string]int{"title": 2}},
+	}}
+	changes, err := EnsureIndexes(ctx, s, db, schema, EnsureOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("changes = %v", changes)
+	}
+	if changes, err := EnsureIndexes(ctx, s, db, schema, EnsureOptions{}); err != nil || len(changes) != 0 {
+		t.Fatalf("second run = %v, %v", changes, err)
+	}
+
+	schema["items"][1].Weights = map[string]int{"title": 3}
+	changes, err = EnsureIndexes(ctx, s, db, schema, EnsureOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []IndexChange{{Collection: "items", Name: "search", Action: IndexRecreated}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
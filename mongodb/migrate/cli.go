@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	mongodb "github.com/ac333d/go-libs/mongodb"
+)
+
+const usage = `usage: migrate [flags] up [version] | down [steps] | status
+
+Connection flags take the parameters of mongodb.Init, or -uri for mongodb.InitURI.
+Environment variables MONGO_HOST, MONGO_PORT, MONGO_USER, MONGO_PASSWORD, MONGO_DB and MONGO_URI
+are used as defaults.
+
+`
+
+// Main - Runs the migrate command line with the given migrations, Registered() if none are given.
+// Migrations are Go code, so a service exposes the command from its own binary:
+//
+//	func main() {
+//		if err := migrate.Main(os.Args[1:]); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+func Main(args []string, migrations ...Migration) error {
+	return run(args, os.Stdout, migrations)
+}
+
+func run(args []string, stdout io.Writer, migrations []Migration) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	port, _ := strconv.Atoi(getenv("MONGO_PORT", "27017"))
+	var (
+		host       = fs.String("host", getenv("MONGO_HOST", "localhost"), "database host")
+		portFlag   = fs.Int("port", port, "database port")
+		username   = fs.String("user", os.Getenv("MONGO_USER"), "username")
+		password   = fs.String("password", os.Getenv("MONGO_PASSWORD"), "password")
+		database   = fs.String("db", os.Getenv("MONGO_DB"), "database to migrate")
+		uri        = fs.String("uri", os.Getenv("MONGO_URI"), "connection string, overrides host, port, user and password")
+		timeout    = fs.Int("timeout", 5, "connection timeout in seconds")
+		collection = fs.String("collection", "schema_migrations", "collection tracking applied migrations")
+		lockTTL    = fs.Duration("lock-ttl", time.Minute, "lease of the migration lock")
+		dryRun     = fs.Bool("dry-run", false, "print the plan without running migrations")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing command")
+	}
+	if *database == "" {
+		return errors.New("missing -db")
+	}
+
+	var (
+		s   mongodb.Session
+		err error
+	)
+	if *uri != "" {
+		s, err = mongodb.InitURI(*uri, *timeout)
+	} else {
+		s, err = mongodb.Init(*host, *portFlag, *username, *password, *database, *timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer mongodb.Close(context.Background(), s)
+
+	if len(migrations) == 0 {
+		migrations = Registered()
+	}
+	m := &Migrator{
+		Session:    s,
+		Database:   *database,
+		Migrations: migrations,
+		Collection: *collection,
+		LockTTL:    *lockTTL,
+		DryRun:     *dryRun,
+		Log:        stdout,
+	}
+	ctx := context.Background()
+
+	cmd, arg := fs.Arg(0), fs.Arg(1)
+	switch cmd {
+	case "up":
+		var target int64
+		if arg != "" {
+			if target, err = strconv.ParseInt(arg, 10, 64); err != nil {
+				return fmt.Errorf("invalid version %s", arg)
+			}
+		}
+		done, err := m.Up(ctx, target)
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(stdout, "no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if arg != "" {
+			if steps, err = strconv.Atoi(arg); err != nil || steps < 1 {
+				return fmt.Errorf("invalid steps %s", arg)
+			}
+		}
+		done, err := m.Down(ctx, steps)
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(stdout, "no applied migrations")
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return printStatus(stdout, statuses)
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown command %s", cmd)
+}
+
+// printStatus - Prints statuses as a table, with a warning listing the migrations without a checksum
+func printStatus(stdout io.Writer, statuses []Status) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED\tDESCRIPTION")
+	var implicit []string
+	for _, st := range statuses {
+		applied := "-"
+		if !st.AppliedAt.IsZero() {
+			applied = st.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", st.Version, st.State, applied, st.Description)
+		if st.ImplicitChecksum {
+			implicit = append(implicit, strconv.FormatInt(st.Version, 10))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(implicit) > 0 {
+		fmt.Fprintf(stdout, "\nwarning: migrations %s have no Checksum, changes to their functions are not detected\n", strings.Join(implicit, ", "))
+	}
+	return nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
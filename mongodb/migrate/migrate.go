@@ -0,0 +1,360 @@
+// Package migrate - Versioned schema migrations for databases accessed through package mongodb
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	mongodb "github.com/ac333d/go-libs/mongodb"
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Func - Migration step, dbname is the database being migrated
+type Func func(ctx context.Context, s mongodb.Session, dbname string) error
+
+// Migration - Versioned migration, versions are applied in increasing order
+type Migration struct {
+	Version     int64 // e.g. a date such as 202401150930
+	Description string
+	Up          Func
+	Down        Func // nil makes the migration irreversible
+	// Checksum identifies the content of the migration, it defaults to a hash of the version and
+	// description only, so edits of Up or Down are NOT detected unless it is set, e.g. to a hash of
+	// the migration source or a revision bumped with every edit. Status flags migrations without one.
+	// Changing an applied migration is reported by Status and stops Up.
+	Checksum string
+}
+
+func (m Migration) checksum() string {
+	if m.Checksum != "" {
+		return m.Checksum
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s", m.Version, m.Description)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Migration
+)
+
+// Register - Adds a migration to the default registry, usually from an init function.
+// Set Migration.Checksum, without it changes to the functions of an applied migration go unnoticed.
+func Register(m Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+}
+
+// Registered - Returns the migrations of the default registry
+func Registered() []Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]Migration(nil), registry...)
+}
+
+// Migration states reported by Status
+const (
+	StatePending  = "pending"
+	StateApplied  = "applied"
+	StateModified = "modified" // applied with a different checksum
+	StateMissing  = "missing"  // applied but no longer registered
+)
+
+// Status - State of one migration
+type Status struct {
+	Version     int64
+	Description string
+	State       string
+	AppliedAt   time.Time
+	// ImplicitChecksum is set for registered migrations without a Checksum, whose edits are not detected
+	ImplicitChecksum bool
+}
+
+// record - Document of an applied migration
+type record struct {
+	Version     int64     `bson:"_id"`
+	Description string    `bson:"description"`
+	Checksum    string    `bson:"checksum"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+	DurationMs  int64     `bson:"durationMs"`
+}
+
+// ErrLocked - Returned when another process holds the migration lock
+var ErrLocked = errors.New("migrations are locked by another process")
+
+// Migrator - Applies migrations to a database
+type Migrator struct {
+	Session    mongodb.Session
+	Database   string
+	Migrations []Migration
+	Collection string        // applied versions, default "schema_migrations"
+	LockTTL    time.Duration // lease of the lock, renewed while migrating, default 1 minute
+	DryRun     bool          // report the plan without running migrations
+	Log        io.Writer     // progress output, default os.Stdout
+}
+
+// New - Creates a migrator for the given migrations, Registered() if none are given.
+// Only the version and description of migrations without a Checksum are checked for changes.
+func New(s mongodb.Session, dbname string, migrations ...Migration) *Migrator {
+	if len(migrations) == 0 {
+		migrations = Registered()
+	}
+	return &Migrator{Session: s, Database: dbname, Migrations: migrations}
+}
+
+func (m *Migrator) collection() *mongo.Collection {
+	name := m.Collection
+	if name == "" {
+		name = "schema_migrations"
+	}
+	return m.Session.Database(m.Database).Collection(name)
+}
+
+func (m *Migrator) lockCollection() *mongo.Collection {
+	return m.Session.Database(m.Database).Collection(m.collection().Name() + "_lock")
+}
+
+func (m *Migrator) logf(format string, args ...interface{}) {
+	w := m.Log
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+// sorted - Returns the migrations in version order, rejecting duplicate versions
+func (m *Migrator) sorted() ([]Migration, error) {
+	migrations := append([]Migration(nil), m.Migrations...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := range migrations {
+		if migrations[i].Up == nil {
+			return nil, fmt.Errorf("migration %d has no up function", migrations[i].Version)
+		}
+		if i > 0 && migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]record, error) {
+	cur, err := m.collection().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Status - Returns the state of every registered or applied migration in version order
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	migrations, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, mig := range migrations {
+		st := Status{Version: mig.Version, Description: mig.Description, State: StatePending, ImplicitChecksum: mig.Checksum == ""}
+		if r, ok := applied[mig.Version]; ok {
+			st.AppliedAt = r.AppliedAt
+			st.State = StateApplied
+			if r.Checksum != mig.checksum() {
+				st.State = StateModified
+			}
+			delete(applied, mig.Version)
+		}
+		statuses = append(statuses, st)
+	}
+	for _, r := range applied {
+		statuses = append(statuses, Status{Version: r.Version, Description: r.Description, State: StateMissing, AppliedAt: r.AppliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up - Applies the pending migrations up to target, 0 applies all, and returns the applied versions
+func (m *Migrator) Up(ctx context.Context, target int64) ([]int64, error) {
+	var done []int64
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			if st.State == StateModified {
+				return fmt.Errorf("migration %d was modified after being applied", st.Version)
+			}
+		}
+
+		migrations, _ := m.sorted()
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if target > 0 && mig.Version > target {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if m.DryRun {
+				m.logf("would apply %d %s", mig.Version, mig.Description)
+				done = append(done, mig.Version)
+				continue
+			}
+
+			m.logf("applying %d %s", mig.Version, mig.Description)
+			start := time.Now()
+			if err := mig.Up(ctx, m.Session, m.Database); err != nil {
+				return fmt.Errorf("error applying migration %d: %v", mig.Version, err)
+			}
+			r := record{
+				Version:     mig.Version,
+				Description: mig.Description,
+				Checksum:    mig.checksum(),
+				AppliedAt:   time.Now().UTC(),
+				DurationMs:  time.Since(start).Milliseconds(),
+			}
+			if _, err := m.collection().InsertOne(ctx, r); err != nil {
+				return fmt.Errorf("error recording migration %d: %v", mig.Version, err)
+			}
+			done = append(done, mig.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down - Reverts the last steps applied migrations and returns the reverted versions
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int64, error) {
+	var done []int64
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		migrations, err := m.sorted()
+		if err != nil {
+			return err
+		}
+		byVersion := make(map[int64]Migration, len(migrations))
+		for _, mig := range migrations {
+			byVersion[mig.Version] = mig
+		}
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for i, v := range versions {
+			if i >= steps {
+				break
+			}
+			mig, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("migration %d is applied but not registered", v)
+			}
+			if mig.Down == nil {
+				return fmt.Errorf("migration %d is irreversible", v)
+			}
+			if m.DryRun {
+				m.logf("would revert %d %s", v, mig.Description)
+				done = append(done, v)
+				continue
+			}
+
+			m.logf("reverting %d %s", v, mig.Description)
+			if err := mig.Down(ctx, m.Session, m.Database); err != nil {
+				return fmt.Errorf("error reverting migration %d: %v", v, err)
+			}
+			if _, err := m.collection().DeleteOne(ctx, bson.M{"_id": v}); err != nil {
+				return fmt.Errorf("error recording revert of migration %d: %v", v, err)
+			}
+			done = append(done, v)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withLock - Runs fn while holding the distributed migration lock, renewing its lease.
+// ctx passed to fn is cancelled if the lease is lost.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	ttl := m.LockTTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	host, _ := os.Hostname()
+	owner := host + ":" + strconv.Itoa(os.Getpid()) + ":" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	if err := m.acquire(ctx, owner, ttl); err != nil {
+		return err
+	}
+	defer m.lockCollection().DeleteOne(context.Background(), bson.M{"_id": "lock", "owner": owner})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.acquire(ctx, owner, ttl); err != nil {
+					m.logf("lost migration lock: %v", err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return fn(ctx)
+}
+
+// acquire - Takes or renews the lock, which is free when missing, expired or already owned
+func (m *Migrator) acquire(ctx context.Context, owner string, ttl time.Duration) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": "lock",
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(ttl)}}
+	_, err := m.lockCollection().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The upsert collided with a lock held by someone else
+		return ErrLocked
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	mongodb "github.com/ac333d/go-libs/mongodb"
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+func noop(ctx context.Context, s mongodb.Session, dbname string) error { return nil }
+
+func TestChecksum(t *testing.T) {
+	m := Migration{Version: 1, Description: "create users", Up: noop}
+	moved := Migration{Version: 1, Description: "create users", Up: func(ctx context.Context, s mongodb.Session, dbname string) error { return nil }}
+	if m.checksum() != moved.checksum() {
+		t.Error("the checksum depends on the up function")
+	}
+	if renamed := (Migration{Version: 1, Description: "create accounts", Up: noop}); m.checksum() == renamed.checksum() {
+		t.Error("the checksum ignores the description")
+	}
+	if explicit := (Migration{Version: 1, Description: "create users", Up: noop, Checksum: "v2"}); explicit.checksum() != "v2" {
+		t.Errorf("checksum = %s, want the explicit one", explicit.checksum())
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	applied := time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC)
+	var out strings.Builder
+	err := printStatus(&out, []Status{
+		{Version: 1, Description: "first", State: StateApplied, AppliedAt: applied, ImplicitChecksum: true},
+		{Version: 2, Description: "second", State: StatePending},
+		{Version: 3, Description: "third", State: StatePending, ImplicitChecksum: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "VERSION  STATE    APPLIED               DESCRIPTION\n" +
+		"1        applied  2024-01-15T09:30:00Z  first\n" +
+		"2        pending  -                     second\n" +
+		"3        pending  -                     third\n" +
+		"\nwarning: migrations 1, 3 have no Checksum, changes to their functions are not detected\n"
+	if out.String() != want {
+		t.Errorf("printStatus =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	printStatus(&out, []Status{{Version: 1, Description: "first", State: StatePending}})
+	if strings.Contains(out.String(), "warning") {
+		t.Errorf("warning printed for explicit checksums:\n%s", out.String())
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI not set")
+	}
+	s, err := mongodb.InitURI(uri, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := fmt.Sprintf("go_libs_test_%d", time.Now().UnixNano())
+	ctx := context.Background()
+	defer mongodb.Close(ctx, s)
+	defer s.Database(db).Drop(ctx)
+
+	insert := func(name string) Func {
+		return func(ctx context.Context, s mongodb.Session, dbname string) error {
+			return mongodb.Insert(ctx, s, dbname, "log", bson.M{"name": name})
+		}
+	}
+	migrations := []Migration{
+		{Version: 2, Description: "second", Up: insert("2"), Down: noop},
+		{Version: 1, Description: "first", Up: insert("1")},
+	}
+	m := New(s, db, migrations...)
+	m.Log = io.Discard
+
+	done, err := m.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2}; !reflect.DeepEqual(done, want) {
+		t.Errorf("Up = %v, want %v", done, want)
+	}
+	if done, err := m.Up(ctx, 0); err != nil || len(done) != 0 {
+		t.Errorf("second Up = %v, %v", done, err)
+	}
+
+	m.Migrations[0].Description = "renamed"
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[1].State != StateModified {
+		t.Errorf("status of the renamed migration = %s, want %s", statuses[1].State, StateModified)
+	}
+	if !statuses[0].ImplicitChecksum {
+		t.Error("migration without a checksum not flagged")
+	}
+	if _, err := m.Up(ctx, 0); err == nil {
+		t.Error("Up accepted a modified migration")
+	}
+
+	m.Migrations[0].Description = "second"
+	if done, err := m.Down(ctx, 1); err != nil || !reflect.DeepEqual(done, []int64{2}) {
+		t.Errorf("Down = %v, %v", done, err)
+	}
+	if _, err := m.Down(ctx, 1); err == nil {
+		t.Error("Down reverted an irreversible migration")
+	}
+}
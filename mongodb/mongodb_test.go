@@ -0,0 +1,199 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// testDatabase - Connects to MONGO_URI and returns a database dropped after the test,
+// the integration tests are skipped when MONGO_URI is not set
+func testDatabase(t *testing.T) (Session, string) {
+	t.Helper()
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI not set")
+	}
+	s, err := InitURI(uri, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbname := fmt.Sprintf("go_libs_test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		s.Database(dbname).Drop(context.Background())
+		Close(context.Background(), s)
+	})
+	return s, dbname
+}
+
+func TestSortDoc(t *testing.T) {
+	got := sortDoc("-created, name,+age,")
+	want := bson.D{{Key: "created", Value: -1}, {Key: "name", Value: 1}, {Key: "age", Value: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortDoc = %v, want %v", got, want)
+	}
+}
+
+func TestIsOperatorDoc(t *testing.T) {
+	tests := []struct {
+		update interface{}
+		want   bool
+	}{
+		{map[string]interface{}{"$set": bson.M{"a": 1}}, true},
+		{bson.M{"a": 1}, false},
+		{bson.D{{Key: "$inc", Value: bson.M{"n": 1}}}, true},
+		{bson.D{{Key: "a", Value: 1}}, false},
+		{[]bson.M{{"$set": bson.M{"a": 1}}}, true},
+	}
+	for _, tt := range tests {
+		if got := isOperatorDoc(tt.update); got != tt.want {
+			t.Errorf("isOperatorDoc(%v) = %v, want %v", tt.update, got, tt.want)
+		}
+	}
+}
+
+func TestCRUD(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+
+	for i, name := range []string{"b", "a", "c"} {
+		if err := Insert(ctx, s, db, "items", bson.M{"_id": i, "name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := Count(ctx, s, db, "items", nil); err != nil || n != 3 {
+		t.Fatalf("Count = %d, %v", n, err)
+	}
+
+	sorted, err := FindAllSorted(ctx, s, db, "items", nil, "-name", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sorted) != 2 || sorted[0].(bson.M)["name"] != "c" || sorted[1].(bson.M)["name"] != "b" {
+		t.Errorf("FindAllSorted = %v", sorted)
+	}
+
+	if err := Update(ctx, s, db, "items", bson.M{"name": "a"}, bson.M{"$set": bson.M{"name": "A"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Update(ctx, s, db, "items", bson.M{"name": "missing"}, bson.M{"$set": bson.M{"x": 1}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of a missing document = %v, want ErrNotFound", err)
+	}
+	if err := Upsert(ctx, s, db, "items", bson.M{"_id": 10}, bson.M{"name": "d"}); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := FindOne(ctx, s, db, "items", bson.M{"_id": 10})
+	if err != nil || doc.(bson.M)["name"] != "d" {
+		t.Errorf("FindOne after Upsert = %v, %v", doc, err)
+	}
+
+	if exists, err := Exists(ctx, s, db, "items", bson.M{"name": "A"}); err != nil || !exists {
+		t.Errorf("Exists = %v, %v", exists, err)
+	}
+	if err := Remove(ctx, s, db, "items", bson.M{"name": "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove of a missing document = %v, want ErrNotFound", err)
+	}
+	if n, err := RemoveAll(ctx, s, db, "items", nil); err != nil || n != 4 {
+		t.Errorf("RemoveAll = %d, %v", n, err)
+	}
+	if _, err := FindOne(ctx, s, db, "items", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindOne in an empty collection = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+
+	type item struct {
+		ID   int    `bson:"_id"`
+		Name string `bson:"name"`
+	}
+	repo := NewRepository[item](s, db, "items")
+	for i, name := range []string{"b", "a"} {
+		if _, err := repo.Insert(ctx, item{ID: i, Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := repo.Find(ctx, nil, FindOptions{Sort: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []item{{1, "a"}, {0, "b"}}; !reflect.DeepEqual(items, want) {
+		t.Errorf("Find = %v, want %v", items, want)
+	}
+	if _, err := repo.FindByID(ctx, 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByID of a missing document = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFindOneAndModify(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := Insert(ctx, s, db, "items", bson.M{"_id": i, "n": 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := func(doc interface{}) interface{} { return doc.(bson.M)["n"] }
+
+	doc, err := FindOneAndUpdate(ctx, s, db, "items", bson.M{"_id": 0}, bson.M{"$inc": bson.M{"n": 1}}, false)
+	if err != nil || n(doc) != int32(0) {
+		t.Errorf("FindOneAndUpdate returning the old document = %v, %v", doc, err)
+	}
+	doc, err = FindOneAndUpdate(ctx, s, db, "items", bson.M{"_id": 0}, bson.M{"$inc": bson.M{"n": 1}}, true)
+	if err != nil || n(doc) != int32(2) {
+		t.Errorf("FindOneAndUpdate returning the new document = %v, %v", doc, err)
+	}
+	// A document without operators replaces the matched one
+	doc, err = FindOneAndUpdate(ctx, s, db, "items", bson.M{"_id": 1}, bson.M{"name": "one"}, true)
+	if err != nil || doc.(bson.M)["name"] != "one" || n(doc) != nil {
+		t.Errorf("FindOneAndUpdate with a replacement = %v, %v", doc, err)
+	}
+	for _, returnNew := range []bool{false, true} {
+		if _, err := FindOneAndUpdate(ctx, s, db, "items", bson.M{"_id": 9}, bson.M{"$inc": bson.M{"n": 1}}, returnNew); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FindOneAndUpdate(returnNew=%v) of a missing document = %v, want ErrNotFound", returnNew, err)
+		}
+	}
+	if _, err := FindOneAndUpdate(ctx, s, db, "items", bson.M{"_id": 9}, bson.M{"name": "nine"}, true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindOneAndUpdate with a replacement of a missing document = %v, want ErrNotFound", err)
+	}
+
+	doc, err = FindOneAndDelete(ctx, s, db, "items", bson.M{"_id": 2})
+	if err != nil || doc.(bson.M)["_id"] != int32(2) {
+		t.Errorf("FindOneAndDelete = %v, %v", doc, err)
+	}
+	if _, err := FindOneAndDelete(ctx, s, db, "items", bson.M{"_id": 2}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second FindOneAndDelete = %v, want ErrNotFound", err)
+	}
+	if count, err := Count(ctx, s, db, "items", nil); err != nil || count != 2 {
+		t.Errorf("Count after FindOneAndDelete = %d, %v", count, err)
+	}
+
+	type item struct {
+		ID int `bson:"_id"`
+		N  int `bson:"n"`
+	}
+	repo := NewRepository[item](s, db, "items")
+	if it, err := repo.FindOneAndUpdate(ctx, bson.M{"_id": 0}, bson.M{"$set": bson.M{"n": 5}}, false); err != nil || it.N != 2 {
+		t.Errorf("Repository.FindOneAndUpdate returning the old document = %+v, %v", it, err)
+	}
+	if it, err := repo.FindOneAndUpdate(ctx, bson.M{"_id": 0}, item{ID: 0, N: 7}, true); err != nil || it.N != 7 {
+		t.Errorf("Repository.FindOneAndUpdate returning the new document = %+v, %v", it, err)
+	}
+	if _, err := repo.FindOneAndUpdate(ctx, bson.M{"_id": 9}, bson.M{"$set": bson.M{"n": 1}}, true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Repository.FindOneAndUpdate of a missing document = %v, want ErrNotFound", err)
+	}
+	if it, err := repo.FindOneAndDelete(ctx, bson.M{"_id": 0}); err != nil || it.N != 7 {
+		t.Errorf("Repository.FindOneAndDelete = %+v, %v", it, err)
+	}
+	if _, err := repo.FindOneAndDelete(ctx, bson.M{"_id": 0}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Repository.FindOneAndDelete of a missing document = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,212 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidToken - Returned for continuation tokens that are malformed or were issued for another sort
+var ErrInvalidToken = errors.New("invalid continuation token")
+
+// DefaultPageSize - Page size used when PageOptions.Limit is not set
+const DefaultPageSize = 20
+
+// PageOptions - Options of keyset pagination
+type PageOptions struct {
+	// Sort is mgo style, e.g. "-created,name"; _id is appended as tie breaker so the order is total.
+	// The sort fields should exist in every document.
+	Sort       string
+	Limit      int64  // default DefaultPageSize
+	Token      string // NextToken of the previous page, empty for the first page
+	WithTotal  bool   // count all documents matching the query
+	Projection map[string]interface{}
+}
+
+// Page - One page of results
+type Page[T any] struct {
+	Items     []T    `json:"items"`
+	NextToken string `json:"nextToken,omitempty"` // empty on the last page
+	Total     int64  `json:"total,omitempty"`     // set with PageOptions.WithTotal
+}
+
+// pageToken - Sort key values of the last document of a page
+type pageToken struct {
+	Sort   string        `bson:"s"`
+	Values []interface{} `bson:"v"`
+}
+
+// FindPage - Finds one page of documents matching query using keyset pagination
+func FindPage(ctx context.Context, s Session, dbname string, collection string, query map[string]interface{}, opts PageOptions) (Page[bson.M], error) {
+	return findPage[bson.M](ctx, s.Database(dbname).Collection(collection), query, opts)
+}
+
+// FindPage - Finds one page of documents matching query using keyset pagination
+func (r *Repository[T]) FindPage(ctx context.Context, query map[string]interface{}, opts PageOptions) (Page[T], error) {
+	return findPage[T](ctx, r.collection(), r.filter(query), opts)
+}
+
+func findPage[T any](ctx context.Context, c *mongo.Collection, query map[string]interface{}, opts PageOptions) (Page[T], error) {
+	var page Page[T]
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageSize
+	}
+	sort := pageSort(opts.Sort)
+
+	if opts.WithTotal {
+		countOpts := options.Count()
+		countOpts.MaxTime = maxTime(ctx)
+		total, err := c.CountDocuments(ctx, filterOf(query), countOpts)
+		if err != nil {
+			return page, err
+		}
+		page.Total = total
+	}
+
+	filter := filterOf(query)
+	if opts.Token != "" {
+		token, err := decodeToken(opts.Token)
+		if err != nil || token.Sort != opts.Sort || len(token.Values) != len(sort) {
+			return page, ErrInvalidToken
+		}
+		keyset := keysetFilter(sort, token.Values)
+		if len(query) > 0 {
+			filter = bson.M{"$and": bson.A{query, keyset}}
+		} else {
+			filter = keyset
+		}
+	}
+
+	// One extra document tells whether there is a next page
+	findOpts := options.Find().SetSort(sort).SetLimit(opts.Limit + 1)
+	findOpts.MaxTime = maxTime(ctx)
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+	cur, err := c.Find(ctx, filter, findOpts)
+	if err != nil {
+		return page, err
+	}
+	defer cur.Close(ctx)
+
+	var last bson.Raw
+	for int64(len(page.Items)) < opts.Limit && cur.Next(ctx) {
+		var object T
+		if err := cur.Decode(&object); err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, object)
+		last = append(bson.Raw(nil), cur.Current...)
+	}
+	if err := cur.Err(); err != nil {
+		return page, err
+	}
+	if last == nil || !cur.Next(ctx) {
+		return page, cur.Err()
+	}
+
+	values := make([]interface{}, len(sort))
+	for i, e := range sort {
+		v, err := last.LookupErr(strings.Split(e.Key, ".")...)
+		if err != nil {
+			return page, errors.New("sort field " + e.Key + " missing from result, check the projection")
+		}
+		values[i] = v
+	}
+	page.NextToken, err = encodeToken(pageToken{Sort: opts.Sort, Values: values})
+	return page, err
+}
+
+// pageSort - Sort of a page with _id appended as tie breaker
+func pageSort(sortParameters string) bson.D {
+	sort := sortDoc(sortParameters)
+	if !hasKey(sort, "_id") {
+		sort = append(sort, bson.E{Key: "_id", Value: 1})
+	}
+	return sort
+}
+
+// keysetFilter - Matches documents after values in sort order:
+// k1 > v1 OR (k1 = v1 AND k2 > v2) OR ...
+// Equality uses $eq so that token values are always compared literally.
+func keysetFilter(sort bson.D, values []interface{}) bson.M {
+	or := make(bson.A, 0, len(sort))
+	for i, e := range sort {
+		cond := make(bson.D, 0, i+1)
+		for j := 0; j < i; j++ {
+			cond = append(cond, bson.E{Key: sort[j].Key, Value: bson.M{"$eq": values[j]}})
+		}
+		op := "$gt"
+		if e.Value == -1 {
+			op = "$lt"
+		}
+		cond = append(cond, bson.E{Key: e.Key, Value: bson.M{op: values[i]}})
+		or = append(or, cond)
+	}
+	return bson.M{"$or": or}
+}
+
+func hasKey(d bson.D, key string) bool {
+	for _, e := range d {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeToken(t pageToken) (string, error) {
+	data, err := bson.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeToken(s string) (pageToken, error) {
+	var t pageToken
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, err
+	}
+	if err := bson.Unmarshal(data, &t); err != nil {
+		return t, err
+	}
+	// Tokens are not signed, a client could replace a value with an operator document
+	for _, v := range t.Values {
+		if hasOperator(v) {
+			return t, ErrInvalidToken
+		}
+	}
+	return t, nil
+}
+
+// hasOperator - Reports whether v is or contains a document with a $ prefixed key
+func hasOperator(v interface{}) bool {
+	switch val := v.(type) {
+	case bson.D:
+		for _, e := range val {
+			if strings.HasPrefix(e.Key, "$") || hasOperator(e.Value) {
+				return true
+			}
+		}
+	case bson.M:
+		for k, e := range val {
+			if strings.HasPrefix(k, "$") || hasOperator(e) {
+				return true
+			}
+		}
+	case bson.A:
+		for _, e := range val {
+			if hasOperator(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPageSort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want bson.D
+	}{
+		{"", bson.D{{Key: "_id", Value: 1}}},
+		{"-created,name", bson.D{{Key: "created", Value: -1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{"name,-_id", bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: -1}}},
+	}
+	for _, tt := range tests {
+		if got := pageSort(tt.sort); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pageSort(%q) = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestKeysetFilter(t *testing.T) {
+	sort := pageSort("-created,name")
+	got := keysetFilter(sort, []interface{}{20, "b", 7})
+	want := bson.M{"$or": bson.A{
+		bson.D{{Key: "created", Value: bson.M{"$lt": 20}}},
+		bson.D{{Key: "created", Value: bson.M{"$eq": 20}}, {Key: "name", Value: bson.M{"$gt": "b"}}},
+		bson.D{{Key: "created", Value: bson.M{"$eq": 20}}, {Key: "name", Value: bson.M{"$eq": "b"}}, {Key: "_id", Value: bson.M{"$gt": 7}}},
+	}}
+	if !sameBSON(t, got, want) {
+		t.Errorf("keysetFilter = %v, want %v", got, want)
+	}
+}
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	raw, err := bson.Marshal(bson.D{{Key: "created", Value: created}, {Key: "meta", Value: bson.D{{Key: "v", Value: int32(2)}}}, {Key: "_id", Value: id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// findPage stores the raw values of the last document
+	values := []interface{}{bson.Raw(raw).Lookup("created"), bson.Raw(raw).Lookup("meta"), bson.Raw(raw).Lookup("_id")}
+	s, err := encodeToken(pageToken{Sort: "-created,meta", Values: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := decodeToken(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{primitive.NewDateTimeFromTime(created), bson.D{{Key: "v", Value: int32(2)}}, id}
+	if token.Sort != "-created,meta" || !reflect.DeepEqual(token.Values, want) {
+		t.Errorf("decodeToken = %+v, want values %v", token, want)
+	}
+}
+
+func TestDecodeTokenInvalid(t *testing.T) {
+	encode := func(values ...interface{}) string {
+		s, err := encodeToken(pageToken{Sort: "name", Values: values})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := encode("b", 7)
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "!!!"},
+		{"not bson", base64.RawURLEncoding.EncodeToString([]byte("garbage"))},
+		{"truncated", valid[:len(valid)-4]},
+		{"operator", encode(bson.M{"$gt": ""}, 7)},
+		{"nested operator", encode("b", bson.D{{Key: "a", Value: bson.M{"$ne": nil}}})},
+		{"operator in array", encode(bson.A{bson.M{"$regex": ".*"}}, 7)},
+	}
+	for _, tt := range tests {
+		if _, err := decodeToken(tt.token); err == nil {
+			t.Errorf("%s: decodeToken accepted %s", tt.name, tt.token)
+		}
+	}
+	if _, err := decodeToken(valid); err != nil {
+		t.Errorf("decodeToken(valid) = %v", err)
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+
+	// Duplicate created values need the _id tie breaker
+	for i := 0; i < 7; i++ {
+		doc := bson.M{"_id": i, "created": i / 3, "name": string(rune('a' + i%2))}
+		if err := Insert(ctx, s, db, "items", doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		ids   []int32
+		token string
+	)
+	for pages := 0; ; pages++ {
+		page, err := FindPage(ctx, s, db, "items", nil, PageOptions{Sort: "-created,name", Limit: 2, Token: token, WithTotal: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 7 {
+			t.Errorf("Total = %d, want 7", page.Total)
+		}
+		for _, item := range page.Items {
+			ids = append(ids, item["_id"].(int32))
+		}
+		if token = page.NextToken; token == "" || pages > 5 {
+			break
+		}
+	}
+	if want := []int32{6, 4, 3, 5, 0, 2, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("pages returned %v, want %v", ids, want)
+	}
+
+	first, err := FindPage(ctx, s, db, "items", bson.M{"name": "a"}, PageOptions{Sort: "name", Limit: 1})
+	if err != nil || first.NextToken == "" {
+		t.Fatalf("FindPage = %+v, %v", first, err)
+	}
+	if _, err := FindPage(ctx, s, db, "items", nil, PageOptions{Sort: "-name", Token: first.NextToken}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of another sort = %v, want ErrInvalidToken", err)
+	}
+	tampered, _ := encodeToken(pageToken{Sort: "name", Values: []interface{}{bson.M{"$gt": ""}, 0}})
+	if _, err := FindPage(ctx, s, db, "items", nil, PageOptions{Sort: "name", Token: tampered}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("tampered token = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,229 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository - Typed access to the documents of one collection, decoded into T with the bson struct tags
+type Repository[T any] struct {
+	Session    Session
+	Database   string
+	Collection string
+	// Behaviors are off by default, see WithBehaviors
+	Behaviors Behaviors
+
+	withDeleted bool
+}
+
+// NewRepository - Binds a repository to a database and collection
+func NewRepository[T any](s Session, dbname, collection string) *Repository[T] {
+	return &Repository[T]{Session: s, Database: dbname, Collection: collection}
+}
+
+// FindOptions - Options of Repository.Find, zero values are ignored
+type FindOptions struct {
+	Sort       string // mgo style sort parameters, e.g. "-created,name"
+	Skip       int64
+	Limit      int64
+	Projection map[string]interface{}
+}
+
+func (r *Repository[T]) collection() *mongo.Collection {
+	return r.Session.Database(r.Database).Collection(r.Collection)
+}
+
+// FindByID - Finds the document with the given _id
+func (r *Repository[T]) FindByID(ctx context.Context, id interface{}) (T, error) {
+	return r.FindOne(ctx, bson.M{"_id": id})
+}
+
+// FindOne - Finds the first document matching query, ErrNotFound if there is none
+func (r *Repository[T]) FindOne(ctx context.Context, query map[string]interface{}) (T, error) {
+	opts := options.FindOne()
+	opts.MaxTime = maxTime(ctx)
+	var object T
+	err := r.collection().FindOne(ctx, filterOf(r.filter(query)), opts).Decode(&object)
+	return object, err
+}
+
+// Find - Finds all documents matching query
+func (r *Repository[T]) Find(ctx context.Context, query map[string]interface{}, opts FindOptions) ([]T, error) {
+	findOpts := options.Find()
+	findOpts.MaxTime = maxTime(ctx)
+	if opts.Sort != "" {
+		findOpts.SetSort(sortDoc(opts.Sort))
+	}
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+
+	cur, err := r.collection().Find(ctx, filterOf(r.filter(query)), findOpts)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTyped[T](ctx, cur)
+}
+
+// Insert - Inserts object and returns its _id
+func (r *Repository[T]) Insert(ctx context.Context, object T) (interface{}, error) {
+	doc, err := r.insertDoc(object)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.collection().InsertOne(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	return res.InsertedID, nil
+}
+
+// Update - Updates the first document matching selector with an update document or a replacement T,
+// ErrNotFound if there is none, or a *ConflictError if it is no longer at the expected version
+func (r *Repository[T]) Update(ctx context.Context, selector map[string]interface{}, update interface{}) error {
+	filter, update, err := r.prepareUpdate(selector, update, false)
+	if err != nil {
+		return err
+	}
+	res, err := updateOne(ctx, r.collection(), filterOf(filter), update, false)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return r.notMatched(ctx, filter)
+	}
+	return nil
+}
+
+// Upsert - Updates the first document matching selector or inserts it,
+// a *ConflictError if the document exists at another version.
+// With Versioning a write at a stale version is caught by the unique index on the selector, _id or
+// another one. Without such an index the second document it inserted is removed again, but readers
+// may see it in between.
+func (r *Repository[T]) Upsert(ctx context.Context, selector map[string]interface{}, update interface{}) error {
+	filter, update, err := r.prepareUpdate(selector, update, true)
+	if err != nil {
+		return err
+	}
+	res, err := updateOne(ctx, r.collection(), filterOf(filter), update, true)
+	if mongo.IsDuplicateKeyError(err) {
+		// The version filter missed the document and the insert collided with it
+		if conflict := r.notMatched(ctx, filter); errors.Is(conflict, ErrConflict) {
+			return conflict
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if _, byID := selector["_id"]; res.UpsertedID == nil || byID {
+		return nil
+	}
+	// The version filter missed the document and nothing prevented a second one
+	conflict, err := r.versionConflict(ctx, filter, res.UpsertedID)
+	if err != nil || conflict == nil {
+		return err
+	}
+	if _, err := r.collection().DeleteOne(ctx, bson.M{"_id": res.UpsertedID}); err != nil {
+		return err
+	}
+	return conflict
+}
+
+// Delete - Deletes the first document matching selector, ErrNotFound if there is none.
+// With SoftDelete the document is only marked deleted, see HardDelete and Restore.
+func (r *Repository[T]) Delete(ctx context.Context, selector map[string]interface{}) error {
+	if r.Behaviors.SoftDelete {
+		res, err := r.collection().UpdateOne(ctx, filterOf(r.filter(selector)), r.softDeleteUpdate())
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		return nil
+	}
+	res, err := r.collection().DeleteOne(ctx, filterOf(selector))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Count - Counts the documents matching query
+func (r *Repository[T]) Count(ctx context.Context, query map[string]interface{}) (int64, error) {
+	opts := options.Count()
+	opts.MaxTime = maxTime(ctx)
+	return r.collection().CountDocuments(ctx, filterOf(r.filter(query)), opts)
+}
+
+// Exists - Reports whether a document matches query
+func (r *Repository[T]) Exists(ctx context.Context, query map[string]interface{}) (bool, error) {
+	return exists(ctx, r.collection(), r.filter(query))
+}
+
+// FindOneAndUpdate - Atomically updates the first document matching selector with an update document
+// or a replacement T, returning it as it was before the update, or after it when returnNew is set.
+// Like Update it returns a *ConflictError if the document is no longer at the expected version.
+func (r *Repository[T]) FindOneAndUpdate(ctx context.Context, selector map[string]interface{}, update interface{}, returnNew bool) (T, error) {
+	var object T
+	filter, update, err := r.prepareUpdate(selector, update, false)
+	if err != nil {
+		return object, err
+	}
+	err = findOneAndUpdate(ctx, r.collection(), filter, update, returnNew).Decode(&object)
+	if err == ErrNotFound {
+		err = r.notMatched(ctx, filter)
+	}
+	return object, err
+}
+
+// FindOneAndDelete - Atomically deletes the first document matching selector and returns it,
+// with SoftDelete the document is marked deleted and returned as it was before
+func (r *Repository[T]) FindOneAndDelete(ctx context.Context, selector map[string]interface{}) (T, error) {
+	var object T
+	var err error
+	if r.Behaviors.SoftDelete {
+		err = findOneAndUpdate(ctx, r.collection(), r.filter(selector), r.softDeleteUpdate(), false).Decode(&object)
+	} else {
+		err = findOneAndDelete(ctx, r.collection(), selector).Decode(&object)
+	}
+	return object, err
+}
+
+// Aggregate - Runs pipeline on the collection of r and decodes the results into R,
+// soft deleted documents are filtered out before the first stage
+func Aggregate[R, T any](ctx context.Context, r *Repository[T], pipeline []bson.M) ([]R, error) {
+	cur, err := aggregate(ctx, r.Session, r.Database, r.Collection, r.pipeline(pipeline))
+	if err != nil {
+		return nil, err
+	}
+	return decodeTyped[R](ctx, cur)
+}
+
+// decodeTyped - Decodes every document of the cursor into T
+func decodeTyped[T any](ctx context.Context, cur *mongo.Cursor) ([]T, error) {
+	defer cur.Close(ctx)
+
+	var objects []T
+	for cur.Next(ctx) {
+		var object T
+		if err := cur.Decode(&object); err != nil {
+			return objects, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, cur.Err()
+}
@@ -0,0 +1,155 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StreamOptions - Options of the streaming functions, zero values are ignored
+type StreamOptions struct {
+	BatchSize    int32 // documents fetched per round trip
+	AllowDiskUse bool  // lets aggregation stages spill to disk, ignored for queries
+	Sort         string
+	Projection   map[string]interface{}
+}
+
+func (o StreamOptions) find(ctx context.Context) *options.FindOptions {
+	opts := options.Find()
+	opts.MaxTime = maxTime(ctx)
+	if o.BatchSize > 0 {
+		opts.SetBatchSize(o.BatchSize)
+	}
+	if o.Sort != "" {
+		opts.SetSort(sortDoc(o.Sort))
+	}
+	if o.Projection != nil {
+		opts.SetProjection(o.Projection)
+	}
+	return opts
+}
+
+func (o StreamOptions) aggregate(ctx context.Context) *options.AggregateOptions {
+	opts := options.Aggregate()
+	opts.MaxTime = maxTime(ctx)
+	if o.BatchSize > 0 {
+		opts.SetBatchSize(o.BatchSize)
+	}
+	if o.AllowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	return opts
+}
+
+func openFind(ctx context.Context, c *mongo.Collection, query map[string]interface{}, opts StreamOptions) (*mongo.Cursor, error) {
+	return c.Find(ctx, filterOf(query), opts.find(ctx))
+}
+
+func openAggregate(ctx context.Context, c *mongo.Collection, pipeline []bson.M, opts StreamOptions) (*mongo.Cursor, error) {
+	if pipeline == nil {
+		pipeline = []bson.M{}
+	}
+	return c.Aggregate(ctx, pipeline, opts.aggregate(ctx))
+}
+
+// ForEach - Calls fn for every document matching query without loading the result set in memory.
+// Iteration stops at the first error returned by fn, a decode error or a cursor error.
+func ForEach(ctx context.Context, s Session, dbname string, collection string, query map[string]interface{}, opts StreamOptions, fn func(bson.M) error) error {
+	cur, err := openFind(ctx, s.Database(dbname).Collection(collection), query, opts)
+	if err != nil {
+		return err
+	}
+	return forEach(ctx, cur, fn)
+}
+
+// PipeForEach - Calls fn for every result of pipeline, see ForEach
+func PipeForEach(ctx context.Context, s Session, dbName string, collection string, pipeline []bson.M, opts StreamOptions, fn func(bson.M) error) error {
+	cur, err := openAggregate(ctx, s.Database(dbName).Collection(collection), pipeline, opts)
+	if err != nil {
+		return err
+	}
+	return forEach(ctx, cur, fn)
+}
+
+// Stream - Sends every document matching query on the first channel.
+// Both channels are closed when the cursor is exhausted, the error channel receives at most one error.
+func Stream(ctx context.Context, s Session, dbname string, collection string, query map[string]interface{}, opts StreamOptions) (<-chan bson.M, <-chan error) {
+	c := s.Database(dbname).Collection(collection)
+	return stream[bson.M](ctx, func() (*mongo.Cursor, error) { return openFind(ctx, c, query, opts) })
+}
+
+// PipeStream - Sends every result of pipeline on the first channel, see Stream
+func PipeStream(ctx context.Context, s Session, dbName string, collection string, pipeline []bson.M, opts StreamOptions) (<-chan bson.M, <-chan error) {
+	c := s.Database(dbName).Collection(collection)
+	return stream[bson.M](ctx, func() (*mongo.Cursor, error) { return openAggregate(ctx, c, pipeline, opts) })
+}
+
+// ForEach - Calls fn for every document matching query, see ForEach
+func (r *Repository[T]) ForEach(ctx context.Context, query map[string]interface{}, opts StreamOptions, fn func(T) error) error {
+	cur, err := openFind(ctx, r.collection(), r.filter(query), opts)
+	if err != nil {
+		return err
+	}
+	return forEach(ctx, cur, fn)
+}
+
+// Stream - Sends every document matching query on the first channel, see Stream
+func (r *Repository[T]) Stream(ctx context.Context, query map[string]interface{}, opts StreamOptions) (<-chan T, <-chan error) {
+	return stream[T](ctx, func() (*mongo.Cursor, error) { return openFind(ctx, r.collection(), r.filter(query), opts) })
+}
+
+// AggregateForEach - Calls fn for every result of pipeline on the collection of r decoded into R
+func AggregateForEach[R, T any](ctx context.Context, r *Repository[T], pipeline []bson.M, opts StreamOptions, fn func(R) error) error {
+	cur, err := openAggregate(ctx, r.collection(), r.pipeline(pipeline), opts)
+	if err != nil {
+		return err
+	}
+	return forEach(ctx, cur, fn)
+}
+
+// forEach - Decodes every document of the cursor into T and calls fn, closing the cursor afterwards
+func forEach[T any](ctx context.Context, cur *mongo.Cursor, fn func(T) error) error {
+	defer cur.Close(context.Background())
+
+	for cur.Next(ctx) {
+		var object T
+		if err := cur.Decode(&object); err != nil {
+			return fmt.Errorf("error decoding document: %w", err)
+		}
+		if err := fn(object); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// stream - Runs forEach in a goroutine feeding a channel until the cursor is exhausted or ctx is cancelled
+func stream[T any](ctx context.Context, open func() (*mongo.Cursor, error)) (<-chan T, <-chan error) {
+	out := make(chan T)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(out)
+
+		cur, err := open()
+		if err != nil {
+			errs <- err
+			return
+		}
+		err = forEach(ctx, cur, func(object T) error {
+			select {
+			case out <- object:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return out, errs
+}
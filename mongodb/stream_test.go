@@ -0,0 +1,161 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// insertNumbers - Inserts documents with _id and n from 0 to count-1
+func insertNumbers(t *testing.T, s Session, db string, count int) {
+	t.Helper()
+	docs := make([]interface{}, count)
+	for i := range docs {
+		docs[i] = bson.M{"_id": i, "n": i, "name": "item"}
+	}
+	if _, err := s.Database(db).Collection("items").InsertMany(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openCursors - Number of cursors open on the server
+func openCursors(t *testing.T, s Session) int64 {
+	t.Helper()
+	var status struct {
+		Metrics struct {
+			Cursor struct {
+				Open struct {
+					Total int64 `bson:"total"`
+				} `bson:"open"`
+			} `bson:"cursor"`
+		} `bson:"metrics"`
+	}
+	if err := s.Database("admin").RunCommand(context.Background(), bson.D{{Key: "serverStatus", Value: 1}}).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status.Metrics.Cursor.Open.Total
+}
+
+func TestForEach(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+	insertNumbers(t, s, db, 10)
+
+	// Small batches keep the cursor open on the server between round trips
+	opts := StreamOptions{BatchSize: 2, Sort: "-n", Projection: map[string]interface{}{"name": 0}}
+	var got []int32
+	err := ForEach(ctx, s, db, "items", bson.M{"n": bson.M{"$gte": 5}}, opts, func(doc bson.M) error {
+		if _, ok := doc["name"]; ok {
+			t.Errorf("projection ignored: %v", doc)
+		}
+		got = append(got, doc["n"].(int32))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int32{9, 8, 7, 6, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ForEach = %v, want %v", got, want)
+	}
+
+	before := openCursors(t, s)
+	stop := errors.New("stop")
+	calls := 0
+	err = ForEach(ctx, s, db, "items", nil, opts, func(bson.M) error {
+		calls++
+		if calls == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || calls != 3 {
+		t.Errorf("ForEach stopped with %v after %d calls, want the callback error after 3", err, calls)
+	}
+	if after := openCursors(t, s); after > before {
+		t.Errorf("%d cursors open after an early stop, %d before", after, before)
+	}
+
+	var sum int32
+	err = PipeForEach(ctx, s, db, "items", []bson.M{{"$group": bson.M{"_id": nil, "sum": bson.M{"$sum": "$n"}}}}, StreamOptions{AllowDiskUse: true}, func(doc bson.M) error {
+		sum = doc["sum"].(int32)
+		return nil
+	})
+	if err != nil || sum != 45 {
+		t.Errorf("PipeForEach sum = %d, %v", sum, err)
+	}
+}
+
+func TestForEachErrors(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+	insertNumbers(t, s, db, 3)
+
+	type wrong struct {
+		Name int `bson:"name"`
+	}
+	err := NewRepository[wrong](s, db, "items").ForEach(ctx, nil, StreamOptions{}, func(wrong) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "error decoding document") {
+		t.Errorf("ForEach into a wrong type = %v, want a decode error", err)
+	}
+
+	err = PipeForEach(ctx, s, db, "items", []bson.M{{"$nope": 1}}, StreamOptions{}, func(bson.M) error { return nil })
+	if err == nil {
+		t.Error("PipeForEach with an invalid stage succeeded")
+	}
+	out, errs := PipeStream(ctx, s, db, "items", []bson.M{{"$nope": 1}}, StreamOptions{})
+	if _, ok := <-out; ok {
+		t.Error("PipeStream sent a document for an invalid pipeline")
+	}
+	if err := <-errs; err == nil {
+		t.Error("PipeStream with an invalid stage sent no error")
+	}
+}
+
+func TestStream(t *testing.T) {
+	s, db := testDatabase(t)
+	insertNumbers(t, s, db, 10)
+
+	type item struct {
+		ID int `bson:"_id"`
+		N  int `bson:"n"`
+	}
+	repo := NewRepository[item](s, db, "items")
+	out, errs := repo.Stream(context.Background(), bson.M{"n": bson.M{"$lt": 4}}, StreamOptions{Sort: "n", BatchSize: 2})
+	var got []int
+	for it := range out {
+		got = append(got, it.N)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stream = %v, want %v", got, want)
+	}
+
+	// A consumer that stops reading cancels the context to end the stream and close the cursor
+	before := openCursors(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, errs := Stream(ctx, s, db, "items", nil, StreamOptions{BatchSize: 2})
+	if _, ok := <-docs; !ok {
+		t.Fatal("Stream sent no document")
+	}
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Stream error after cancel = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stream did not stop after cancel")
+	}
+	for range docs {
+	}
+	if after := openCursors(t, s); after > before {
+		t.Errorf("%d cursors open after cancel, %d before", after, before)
+	}
+}
@@ -0,0 +1,100 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxTransactionRetries - Attempts of WithTransaction after TransientTransactionError,
+// and of each commit after UnknownTransactionCommitResult
+var MaxTransactionRetries = 5
+
+// TransactionRetryTimeout - Time after which WithTransaction stops retrying, as the driver's Session.WithTransaction
+var TransactionRetryTimeout = 120 * time.Second
+
+// Error labels of retryable transaction failures
+const (
+	TransientTransactionError      = "TransientTransactionError"
+	UnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// TxContext - Transaction scoped handle passed to the WithTransaction callback.
+// Every function and Repository method of this package called with it as ctx runs inside the transaction.
+type TxContext = mongo.SessionContext
+
+// WithTransaction - Runs fn in a transaction committed when fn returns nil and aborted otherwise.
+// The whole transaction is retried on TransientTransactionError and the commit on
+// UnknownTransactionCommitResult, so fn may run several times and must not have other side effects.
+// Retries back off a little more after every attempt and stop after MaxTransactionRetries or TransactionRetryTimeout.
+//
+//	err := mongodb.WithTransaction(ctx, s, func(tx mongodb.TxContext) error {
+//		if err := mongodb.Insert(tx, s, "shop", "orders", order); err != nil {
+//			return err
+//		}
+//		return mongodb.Update(tx, s, "shop", "stock", selector, update)
+//	})
+func WithTransaction(ctx context.Context, s Session, fn func(tx TxContext) error, opts ...*options.TransactionOptions) error {
+	sess, err := s.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.Background())
+
+	txOpts := options.MergeTransactionOptions(opts...)
+	deadline := time.Now().Add(TransactionRetryTimeout)
+	for attempt := 0; ; attempt++ {
+		err = mongo.WithSession(ctx, sess, func(tx mongo.SessionContext) error {
+			if err := sess.StartTransaction(txOpts); err != nil {
+				return err
+			}
+			if err := fn(tx); err != nil {
+				// Abort even if ctx is done so the server releases the locks
+				sess.AbortTransaction(context.Background())
+				return err
+			}
+			return commit(tx, sess, deadline)
+		})
+		if err == nil || !hasErrorLabel(err, TransientTransactionError) ||
+			attempt >= MaxTransactionRetries || !time.Now().Before(deadline) {
+			return err
+		}
+		if err := retryWait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// commit - Commits the transaction of sess, retrying while the outcome is unknown
+func commit(tx TxContext, sess mongo.Session, deadline time.Time) error {
+	for attempt := 0; ; attempt++ {
+		err := sess.CommitTransaction(tx)
+		if err == nil || !hasErrorLabel(err, UnknownTransactionCommitResult) ||
+			attempt >= MaxTransactionRetries || !time.Now().Before(deadline) {
+			return err
+		}
+		if waitErr := retryWait(tx, attempt); waitErr != nil {
+			return err
+		}
+	}
+}
+
+// retryWait - Sleeps 10ms longer after every attempt, returning early with the error of ctx
+func retryWait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(time.Duration(attempt+1) * 10 * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
@@ -0,0 +1,126 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	bson "go.mongodb.org/mongo-driver/bson"
+)
+
+// The transaction tests need MONGO_URI to point to a replica set
+func TestWithTransaction(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+	for _, doc := range []bson.M{{"_id": 1, "n": 0}, {"_id": 2}} {
+		if err := Insert(ctx, s, db, "items", doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(query bson.M) int {
+		n, err := Count(ctx, s, db, "items", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	err := WithTransaction(ctx, s, func(tx TxContext) error {
+		if err := Update(tx, s, db, "items", bson.M{"_id": 1}, bson.M{"$inc": bson.M{"n": 1}}); err != nil {
+			return err
+		}
+		return Insert(tx, s, db, "items", bson.M{"_id": 3})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count(bson.M{"_id": 1, "n": 1}) != 1 || count(bson.M{"_id": 3}) != 1 {
+		t.Error("committed writes not visible")
+	}
+
+	abort := errors.New("abort")
+	err = WithTransaction(ctx, s, func(tx TxContext) error {
+		if err := Insert(tx, s, db, "items", bson.M{"_id": 4}); err != nil {
+			return err
+		}
+		if count(bson.M{"_id": 4}) != 0 {
+			t.Error("uncommitted insert visible outside the transaction")
+		}
+		return abort
+	})
+	if err != abort {
+		t.Errorf("WithTransaction = %v, want the callback error", err)
+	}
+	if count(bson.M{"_id": 4}) != 0 {
+		t.Error("insert of an aborted transaction was kept")
+	}
+}
+
+func TestWithTransactionRetriesTransientErrors(t *testing.T) {
+	s, db := testDatabase(t)
+	ctx := context.Background()
+	for _, doc := range []bson.M{{"_id": 1, "n": 0}, {"_id": 2}} {
+		if err := Insert(ctx, s, db, "items", doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	attempts := 0
+	var firstErr error
+	err := WithTransaction(ctx, s, func(tx TxContext) error {
+		attempts++
+		// The first read fixes the snapshot of the transaction
+		if _, err := FindOne(tx, s, db, "items", bson.M{"_id": 2}); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			// A write outside the transaction after its snapshot makes the next write conflict
+			if err := Update(ctx, s, db, "items", bson.M{"_id": 1}, bson.M{"$inc": bson.M{"n": 1}}); err != nil {
+				return err
+			}
+		}
+		err := Update(tx, s, db, "items", bson.M{"_id": 1}, bson.M{"$inc": bson.M{"n": 1}})
+		if attempts == 1 {
+			firstErr = err
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || !hasErrorLabel(firstErr, TransientTransactionError) {
+		t.Errorf("%d attempts, first error %v, want a retry after a TransientTransactionError", attempts, firstErr)
+	}
+	doc, err := FindOne(ctx, s, db, "items", bson.M{"_id": 1})
+	if err != nil || doc.(bson.M)["n"] != int32(2) {
+		t.Errorf("document after the retried transaction = %v, %v", doc, err)
+	}
+
+	// Retries stop after MaxTransactionRetries
+	defer func(n int) { MaxTransactionRetries = n }(MaxTransactionRetries)
+	MaxTransactionRetries = 1
+	attempts = 0
+	transient := &labeledError{error: errors.New("conflict"), labels: []string{TransientTransactionError}}
+	err = WithTransaction(ctx, s, func(tx TxContext) error {
+		attempts++
+		return transient
+	})
+	if !errors.Is(err, transient) || attempts != 2 {
+		t.Errorf("WithTransaction = %v after %d attempts, want the transient error after 2", err, attempts)
+	}
+}
+
+// labeledError - Error carrying server error labels
+type labeledError struct {
+	error
+	labels []string
+}
+
+func (e *labeledError) HasErrorLabel(label string) bool {
+	for _, l := range e.labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,337 @@
+package nethttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator - Adds credentials to an outgoing request
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc - Adapts a function to an Authenticator
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate - Authenticate
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// tokenInvalidator is implemented by authenticators whose cached credentials can be rejected by the server
+type tokenInvalidator interface {
+	Invalidate()
+}
+
+// AuthTransport - RoundTripper authenticating every request, e.g. NewClient(NewAuthTransport(BearerToken(t), nil))
+type AuthTransport struct {
+	Transport http.RoundTripper // nil uses http.DefaultTransport
+	Auth      Authenticator
+}
+
+// NewAuthTransport - Creates an AuthTransport on top of next, nil uses http.DefaultTransport
+func NewAuthTransport(auth Authenticator, next http.RoundTripper) *AuthTransport {
+	return &AuthTransport{Transport: next, Auth: auth}
+}
+
+// RoundTrip - Authenticates a copy of the request and retries once with fresh credentials on 401
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	authReq, err := t.authenticate(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := transport.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	inv, ok := t.Auth.(tokenInvalidator)
+	if !ok || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	inv.Invalidate()
+
+	retry := req
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry = req.Clone(req.Context())
+		retry.Body = body
+	}
+	if authReq, err = t.authenticate(retry); err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(authReq)
+}
+
+func (t *AuthTransport) authenticate(req *http.Request) (*http.Request, error) {
+	authReq := req.Clone(req.Context())
+	if err := t.Auth.Authenticate(authReq); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("error authenticating request: %v", err)
+	}
+	return authReq, nil
+}
+
+// BearerToken - Authenticator sending a static bearer token
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BasicAuth - Authenticator sending HTTP basic credentials
+func BasicAuth(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// ClientCredentials - OAuth2 client credentials grant (RFC 6749 4.4) with token caching and proactive refresh
+type ClientCredentials struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams url.Values
+	// RefreshBefore refreshes the token in the background this long before it expires, default 1m
+	RefreshBefore time.Duration
+	// HTTPClient used to fetch tokens, default a client with a 10 second timeout
+	HTTPClient *http.Client
+
+	fetchMu    sync.Mutex
+	mu         sync.Mutex
+	token      string
+	tokenType  string
+	expiry     time.Time
+	refreshing bool
+}
+
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+// Authenticate - Sets the cached access token, fetching a new one when it expired
+func (c *ClientCredentials) Authenticate(req *http.Request) error {
+	token, tokenType, err := c.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", tokenType+" "+token)
+	return nil
+}
+
+// Token - Returns a valid access token and its type
+func (c *ClientCredentials) Token(ctx context.Context) (string, string, error) {
+	if token, tokenType, ok := c.cached(true); ok {
+		return token, tokenType, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// Another caller may have fetched a token while we waited
+	if token, tokenType, ok := c.cached(false); ok {
+		return token, tokenType, nil
+	}
+	if err := c.fetch(ctx); err != nil {
+		return "", "", err
+	}
+	token, tokenType, _ := c.cached(false)
+	return token, tokenType, nil
+}
+
+// cached returns the cached token if it is still valid, optionally starting a background refresh when it expires soon
+func (c *ClientCredentials) cached(refresh bool) (string, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.token == "" || (!c.expiry.IsZero() && !now.Before(c.expiry)) {
+		return "", "", false
+	}
+	if refresh && !c.refreshing && !c.expiry.IsZero() && now.Add(c.refreshBefore()).After(c.expiry) {
+		c.refreshing = true
+		go func() {
+			c.fetchMu.Lock()
+			defer c.fetchMu.Unlock()
+			// A failed background refresh is retried by the next call
+			c.fetch(context.Background())
+		}()
+	}
+	return c.token, c.tokenType, true
+}
+
+// Invalidate - Drops the cached token so the next request fetches a new one
+func (c *ClientCredentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+}
+
+func (c *ClientCredentials) refreshBefore() time.Duration {
+	if c.RefreshBefore > 0 {
+		return c.RefreshBefore
+	}
+	return time.Minute
+}
+
+// fetch requests a new token from the token endpoint, callers hold fetchMu
+func (c *ClientCredentials) fetch(ctx context.Context) error {
+	defer func() {
+		c.mu.Lock()
+		c.refreshing = false
+		c.mu.Unlock()
+	}()
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	for k, v := range c.EndpointParams {
+		form[k] = v
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error reading token response: %v", err)
+	}
+	var tr tokenResponse
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return fmt.Errorf("error decoding token response (%d): %s", resp.StatusCode, string(data))
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		if tr.Error != "" {
+			return fmt.Errorf("error fetching token: %s %s", tr.Error, tr.ErrorDescription)
+		}
+		return fmt.Errorf("error fetching token (%d): %s", resp.StatusCode, string(data))
+	}
+
+	tokenType := tr.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	var expiry time.Time
+	if seconds, err := tr.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token, c.tokenType, c.expiry = tr.AccessToken, tokenType, expiry
+	return nil
+}
+
+// HMACSigner - Signs requests with a shared secret.
+// The signature is the base64 HMAC of "METHOD\nPATH?QUERY\nTIMESTAMP\nHEX(SHA256(BODY))",
+// sent as "Authorization: HMAC-SHA256 KeyId=<id>, Signature=<sig>" along with the
+// X-Timestamp and X-Content-Sha256 headers.
+type HMACSigner struct {
+	KeyID  string
+	Secret []byte
+	Hash   func() hash.Hash // default sha256.New
+
+	now func() time.Time
+}
+
+// Authenticate - Authenticate
+func (s *HMACSigner) Authenticate(req *http.Request) error {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	bodySum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(bodySum[:])
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+
+	h := s.Hash
+	if h == nil {
+		h = sha256.New
+	}
+	mac := hmac.New(h, s.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", req.Method, req.URL.RequestURI(), timestamp, bodyHash)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Content-Sha256", bodyHash)
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 KeyId=%s, Signature=%s", s.KeyID, signature))
+	return nil
+}
+
+// readRequestBody returns the request body and replaces it so it can be sent afterwards
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
@@ -0,0 +1,219 @@
+package nethttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer issues tokens t1, t2, ... that expire after expiresIn seconds
+type tokenServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	issued    int
+	expiresIn int
+	forms     []string
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	ts := &tokenServer{expiresIn: expiresIn}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "client" || pass != "s%C3%A9cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"invalid_client","error_description":"bad credentials"}`)
+			return
+		}
+		r.ParseForm()
+		ts.mu.Lock()
+		ts.issued++
+		ts.forms = append(ts.forms, r.PostForm.Encode())
+		n := ts.issued
+		ts.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"t%d","token_type":"bearer","expires_in":%d}`, n, ts.expiresIn)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *tokenServer) count() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.issued
+}
+
+func TestClientCredentialsCaching(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	cc := &ClientCredentials{
+		TokenURL:       ts.URL,
+		ClientID:       "client",
+		ClientSecret:   "sécret",
+		Scopes:         []string{"read", "write"},
+		EndpointParams: map[string][]string{"audience": {"api"}},
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		token, tokenType, err := cc.Token(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "t1" || tokenType != "Bearer" {
+			t.Errorf("Token = %s %s, want Bearer t1", tokenType, token)
+		}
+	}
+	if n := ts.count(); n != 1 {
+		t.Errorf("%d token requests, want 1", n)
+	}
+	if want := "audience=api&grant_type=client_credentials&scope=read+write"; ts.forms[0] != want {
+		t.Errorf("token request form = %s, want %s", ts.forms[0], want)
+	}
+
+	cc.Invalidate()
+	req := httptest.NewRequest("GET", "/", nil)
+	if err := cc.Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer t2" {
+		t.Errorf("Authorization after Invalidate = %q, want Bearer t2", got)
+	}
+}
+
+func TestClientCredentialsEarlyRefresh(t *testing.T) {
+	ts := newTokenServer(t, 60)
+	cc := &ClientCredentials{TokenURL: ts.URL, ClientID: "client", ClientSecret: "sécret", RefreshBefore: 2 * time.Minute}
+	ctx := context.Background()
+
+	if token, _, err := cc.Token(ctx); err != nil || token != "t1" {
+		t.Fatalf("Token = %s, %v", token, err)
+	}
+	// The token expires within RefreshBefore, it is still used while a new one is fetched
+	if token, _, err := cc.Token(ctx); err != nil || token != "t1" {
+		t.Fatalf("Token during refresh = %s, %v", token, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for ts.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if token, _, _ := cc.cached(false); token != "t2" {
+		t.Errorf("token after background refresh = %s, want t2", token)
+	}
+}
+
+func TestClientCredentialsErrors(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	cc := &ClientCredentials{TokenURL: ts.URL, ClientID: "client", ClientSecret: "wrong"}
+	_, _, err := cc.Token(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "invalid_client bad credentials") {
+		t.Errorf("Token with bad credentials = %v", err)
+	}
+
+	garbage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html>")
+	}))
+	defer garbage.Close()
+	cc = &ClientCredentials{TokenURL: garbage.URL}
+	if _, _, err := cc.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "error decoding token response") {
+		t.Errorf("Token with an invalid response = %v", err)
+	}
+}
+
+func TestAuthTransportRetriesAfterUnauthorized(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	var bodies []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		// The first token was revoked
+		if r.Header.Get("Authorization") != "Bearer t2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer api.Close()
+
+	cc := &ClientCredentials{TokenURL: ts.URL, ClientID: "client", ClientSecret: "sécret"}
+	client := &http.Client{Transport: NewAuthTransport(cc, nil)}
+	resp, err := client.Post(api.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Errorf("bodies = %q, want the payload sent twice", bodies)
+	}
+
+	// Static credentials are not retried
+	bodies = nil
+	client = &http.Client{Transport: NewAuthTransport(BearerToken("t1"), nil)}
+	resp, err = client.Get(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || len(bodies) != 1 {
+		t.Errorf("static token: status %d after %d requests", resp.StatusCode, len(bodies))
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	s := &HMACSigner{KeyID: "key-1", Secret: []byte("secret"), now: func() time.Time { return time.Unix(1700000000, 0) }}
+	tests := []struct {
+		method, url, body string
+		hash, signature   string
+	}{
+		{"POST", "https://api.example/v1/orders?expand=items", `{"amount":5}`,
+			"7e84cbf0f7a7c92c037058665d66152f8eb8580ab2534e52c877bccceb9cc7bf",
+			"KaNCgUMGn5HzcCODoX0ZPF8OsyrUy2w823qAgHKyXuI="},
+		{"GET", "https://api.example/", "",
+			"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			"pvKjdYwnAYIh3m0ymPqkh2t+r+anNSicsKxTebnKayc="},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if err := s.Authenticate(req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("X-Content-Sha256"); got != tt.hash {
+			t.Errorf("%s %s: X-Content-Sha256 = %s, want %s", tt.method, tt.url, got, tt.hash)
+		}
+		if got := req.Header.Get("X-Timestamp"); got != "1700000000" {
+			t.Errorf("%s %s: X-Timestamp = %s", tt.method, tt.url, got)
+		}
+		if got, want := req.Header.Get("Authorization"), "HMAC-SHA256 KeyId=key-1, Signature="+tt.signature; got != want {
+			t.Errorf("%s %s: Authorization = %s, want %s", tt.method, tt.url, got, want)
+		}
+		// The body can still be sent after signing
+		if body, _ := io.ReadAll(req.Body); string(body) != tt.body {
+			t.Errorf("%s %s: body after signing = %q", tt.method, tt.url, body)
+		}
+	}
+}
+
+func TestSigV4Signer(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite
+	s := NewStaticSigV4Signer("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "service", "us-east-1")
+	s.now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err := s.Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %s\nwant %s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %s", got)
+	}
+}
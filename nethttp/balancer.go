@@ -0,0 +1,406 @@
+package nethttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EndpointResolver - Source of the endpoints of a replicated service
+type EndpointResolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// StaticEndpoints - Resolver returning a fixed list of base URLs
+type StaticEndpoints []string
+
+// Resolve - Resolve
+func (s StaticEndpoints) Resolve(ctx context.Context) ([]string, error) {
+	return s, nil
+}
+
+// SRVEndpoints - Resolver using DNS SRV records, e.g. _http._tcp.orders.service.consul
+type SRVEndpoints struct {
+	Service string // e.g. "http", empty to look up Name directly
+	Proto   string // e.g. "tcp"
+	Name    string
+	Scheme  string // default "http"
+}
+
+// Resolve - Returns the targets of the highest priority SRV records as base URLs
+func (s SRVEndpoints) Resolve(ctx context.Context) ([]string, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, s.Service, s.Proto, s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving srv %s: %v", s.Name, err)
+	}
+	scheme := s.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	var endpoints []string
+	for _, r := range records {
+		if r.Priority != records[0].Priority {
+			break
+		}
+		host := strings.TrimSuffix(r.Target, ".")
+		endpoints = append(endpoints, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+	}
+	return endpoints, nil
+}
+
+// BalancePolicy - Endpoint selection strategy of a Balancer
+type BalancePolicy int
+
+const (
+	// RoundRobin cycles through healthy endpoints
+	RoundRobin BalancePolicy = iota
+	// LeastOutstanding picks the healthy endpoint with the fewest in-flight requests
+	LeastOutstanding
+	// PowerOfTwoChoices picks the less loaded of two random healthy endpoints
+	PowerOfTwoChoices
+)
+
+// BalancerOptions - Configuration of a Balancer, zero values use the defaults below
+type BalancerOptions struct {
+	Policy BalancePolicy
+	// MaxRetries on other endpoints after connection errors or 502, 503 and 504 responses,
+	// default 2, -1 disables retries
+	MaxRetries int
+	// RetryNonIdempotent also retries POST and PATCH requests without an Idempotency-Key header,
+	// which may then be processed twice
+	RetryNonIdempotent bool
+	// FailureThreshold consecutive failures eject an endpoint, default 5
+	FailureThreshold int
+	// EjectionTime is the base ejection duration, multiplied by the number of ejections, default 30s
+	EjectionTime time.Duration
+	// MaxEjectionPercent of the endpoints that may be ejected at once, default 50
+	MaxEjectionPercent int
+	// RefreshInterval of the resolver, default 30s
+	RefreshInterval time.Duration
+}
+
+type endpoint struct {
+	base        *url.URL
+	outstanding atomic.Int64
+
+	mu           sync.Mutex
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+func (e *endpoint) ejected(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return now.Before(e.ejectedUntil)
+}
+
+// Balancer - RoundTripper spreading requests over the endpoints of a service.
+// The scheme and host of every request are replaced by the selected endpoint,
+// e.g. c.GetBytes("http://orders/v1/orders", nil, nil) with a balanced client.
+type Balancer struct {
+	Transport http.RoundTripper // nil uses http.DefaultTransport
+
+	opts     BalancerOptions
+	resolver EndpointResolver
+
+	mu        sync.RWMutex
+	endpoints []*endpoint
+	next      atomic.Uint64
+	stop      chan struct{}
+	once      sync.Once
+}
+
+// NewBalancer - Resolves the endpoints and keeps refreshing them until Close is called
+func NewBalancer(resolver EndpointResolver, opts BalancerOptions, next http.RoundTripper) (*Balancer, error) {
+	switch {
+	case opts.MaxRetries == 0:
+		opts.MaxRetries = 2
+	case opts.MaxRetries == -1:
+		opts.MaxRetries = 0
+	case opts.MaxRetries < 0:
+		return nil, fmt.Errorf("invalid MaxRetries %d", opts.MaxRetries)
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.EjectionTime <= 0 {
+		opts.EjectionTime = 30 * time.Second
+	}
+	if opts.MaxEjectionPercent <= 0 {
+		opts.MaxEjectionPercent = 50
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = 30 * time.Second
+	}
+
+	b := &Balancer{
+		Transport: next,
+		opts:      opts,
+		resolver:  resolver,
+		stop:      make(chan struct{}),
+	}
+	if err := b.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	if _, static := resolver.(StaticEndpoints); !static {
+		go b.refreshLoop()
+	}
+	return b, nil
+}
+
+// NewBalancedClient - Creates a client balancing over static endpoints
+func NewBalancedClient(opts BalancerOptions, endpoints ...string) (*Client, error) {
+	b, err := NewBalancer(StaticEndpoints(endpoints), opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(b), nil
+}
+
+// Refresh - Re-resolves the endpoints, keeping the state of endpoints that remain
+func (b *Balancer) Refresh(ctx context.Context) error {
+	urls, err := b.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return errors.New("no endpoints resolved")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	existing := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		existing[e.base.String()] = e
+	}
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid endpoint %s", raw)
+		}
+		if e, ok := existing[u.String()]; ok {
+			endpoints = append(endpoints, e)
+			continue
+		}
+		endpoints = append(endpoints, &endpoint{base: u})
+	}
+	b.endpoints = endpoints
+	return nil
+}
+
+func (b *Balancer) refreshLoop() {
+	ticker := time.NewTicker(b.opts.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), b.opts.RefreshInterval)
+			// Keep the last known endpoints when resolution fails
+			_ = b.Refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// Close - Stops refreshing the endpoints
+func (b *Balancer) Close() {
+	b.once.Do(func() { close(b.stop) })
+}
+
+// pick selects an endpoint that hasn't been tried, preferring healthy ones
+func (b *Balancer) pick(tried map[*endpoint]bool) *endpoint {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	var healthy, fallback []*endpoint
+	for _, e := range b.endpoints {
+		if tried[e] {
+			continue
+		}
+		if e.ejected(now) {
+			fallback = append(fallback, e)
+			continue
+		}
+		healthy = append(healthy, e)
+	}
+	if len(healthy) == 0 {
+		healthy = fallback
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	switch b.opts.Policy {
+	case LeastOutstanding:
+		best := healthy[0]
+		for _, e := range healthy[1:] {
+			if e.outstanding.Load() < best.outstanding.Load() {
+				best = e
+			}
+		}
+		return best
+	case PowerOfTwoChoices:
+		if len(healthy) == 1 {
+			return healthy[0]
+		}
+		i := rand.Intn(len(healthy))
+		j := rand.Intn(len(healthy) - 1)
+		if j >= i {
+			j++
+		}
+		if healthy[j].outstanding.Load() < healthy[i].outstanding.Load() {
+			return healthy[j]
+		}
+		return healthy[i]
+	}
+	return healthy[int(b.next.Add(1)-1)%len(healthy)]
+}
+
+// report records the outcome of a request for passive outlier detection
+func (b *Balancer) report(e *endpoint, failed bool) {
+	e.mu.Lock()
+	if !failed {
+		e.failures = 0
+		e.mu.Unlock()
+		return
+	}
+	e.failures++
+	eject := e.failures >= b.opts.FailureThreshold
+	e.mu.Unlock()
+
+	if !eject || !b.canEject() {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ejections++
+	e.failures = 0
+	e.ejectedUntil = time.Now().Add(time.Duration(e.ejections) * b.opts.EjectionTime)
+}
+
+// canEject enforces MaxEjectionPercent
+func (b *Balancer) canEject() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	ejected := 0
+	for _, e := range b.endpoints {
+		if e.ejected(now) {
+			ejected++
+		}
+	}
+	return (ejected+1)*100 <= len(b.endpoints)*b.opts.MaxEjectionPercent
+}
+
+// RoundTrip - Sends the request to a selected endpoint, retrying on another endpoint when it fails
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := b.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	retryable := (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) &&
+		(b.opts.RetryNonIdempotent || isIdempotent(req))
+	tried := make(map[*endpoint]bool)
+	var lastErr error
+	for attempt := 0; attempt <= b.opts.MaxRetries; attempt++ {
+		e := b.pick(tried)
+		if e == nil {
+			break
+		}
+		tried[e] = true
+
+		out := req.Clone(req.Context())
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			out.Body = body
+		}
+		out.URL.Scheme = e.base.Scheme
+		out.URL.Host = e.base.Host
+		if p := strings.TrimSuffix(e.base.Path, "/"); p != "" {
+			out.URL.Path = p + out.URL.Path
+			if out.URL.RawPath != "" {
+				out.URL.RawPath = p + out.URL.RawPath
+			}
+		}
+		out.Host = ""
+
+		e.outstanding.Add(1)
+		resp, err := transport.RoundTrip(out)
+		if err != nil {
+			e.outstanding.Add(-1)
+			b.report(e, true)
+			lastErr = err
+			if !retryable || req.Context().Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		failed := resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout
+		b.report(e, failed || resp.StatusCode >= 500)
+		if failed && retryable && attempt < b.opts.MaxRetries && len(tried) < b.size() {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			e.outstanding.Add(-1)
+			lastErr = fmt.Errorf("endpoint %s responded %d", e.base.Host, resp.StatusCode)
+			continue
+		}
+		resp.Body = &outstandingBody{ReadCloser: resp.Body, e: e}
+		return resp, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no endpoint available")
+	}
+	return nil, lastErr
+}
+
+// isIdempotent reports whether req can be sent twice, as http.Transport does it for its own retries
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, key := req.Header["Idempotency-Key"]
+	_, xkey := req.Header["X-Idempotency-Key"]
+	return key || xkey
+}
+
+func (b *Balancer) size() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.endpoints)
+}
+
+// outstandingBody releases the in-flight slot of an endpoint once the response is consumed
+type outstandingBody struct {
+	io.ReadCloser
+	e    *endpoint
+	once sync.Once
+}
+
+func (b *outstandingBody) Close() error {
+	b.once.Do(func() { b.e.outstanding.Add(-1) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,76 @@
+package nethttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func balancerEndpoints(t *testing.T) (down, up *httptest.Server, downHits *atomic.Int32) {
+	downHits = new(atomic.Int32)
+	down = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	up = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(down.Close)
+	t.Cleanup(up.Close)
+	return down, up, downHits
+}
+
+func balancedStatus(t *testing.T, b *Balancer, method string, header http.Header) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, "http://service/path", strings.NewReader("{}"))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := b.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestBalancerRetries(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   BalancerOptions
+		method string
+		header http.Header
+		want   int
+	}{
+		{"idempotent", BalancerOptions{}, "PUT", nil, http.StatusOK},
+		{"non idempotent", BalancerOptions{}, "POST", nil, http.StatusServiceUnavailable},
+		{"idempotency key", BalancerOptions{}, "POST", http.Header{"Idempotency-Key": {"1"}}, http.StatusOK},
+		{"opt in", BalancerOptions{RetryNonIdempotent: true}, "PATCH", nil, http.StatusOK},
+		{"disabled", BalancerOptions{MaxRetries: -1}, "GET", nil, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			down, up, downHits := balancerEndpoints(t)
+			b, err := NewBalancer(StaticEndpoints{down.URL, up.URL}, tt.opts, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code := balancedStatus(t, b, tt.method, tt.header); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+			if n := downHits.Load(); n != 1 {
+				t.Errorf("failing endpoint received %d requests", n)
+			}
+		})
+	}
+}
+
+func TestBalancerInvalidMaxRetries(t *testing.T) {
+	if _, err := NewBalancer(StaticEndpoints{"http://127.0.0.1"}, BalancerOptions{MaxRetries: -2}, nil); err == nil {
+		t.Error("NewBalancer accepted MaxRetries -2")
+	}
+}
@@ -0,0 +1,448 @@
+package nethttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxBindBodySize - Largest body accepted by BindJSON
+var MaxBindBodySize int64 = 1 << 20
+
+// FieldError - Validation failure of a single field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Problem - RFC 7807 problem details, returned as error by the Bind functions
+type Problem struct {
+	Type     string       `json:"type,omitempty"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+func newProblem(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// WriteProblem - Writes err as an application/problem+json response, errors other than *Problem become a 500.
+// A Problem without a valid status is sent as a 400 when it lists field errors and as a 500 otherwise.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Problem
+	if !errors.As(err, &p) {
+		p = newProblem(http.StatusInternalServerError, "")
+	}
+	c := *p
+	if c.Status < 100 || c.Status > 599 {
+		c.Status = http.StatusInternalServerError
+		if len(c.Errors) > 0 {
+			c.Status = http.StatusBadRequest
+		}
+	}
+	if c.Title == "" {
+		c.Title = http.StatusText(c.Status)
+	}
+	if c.Instance == "" && r != nil {
+		c.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(c.Status)
+	json.NewEncoder(w).Encode(&c)
+}
+
+// BindJSON - Decodes the JSON body of r into dst and validates it.
+// Failures are returned as *Problem: 415 for a wrong content type, 413 for a body over
+// MaxBindBodySize, 400 for malformed JSON or unknown fields and 422 for validation errors.
+func BindJSON(r *http.Request, dst interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return newProblem(http.StatusUnsupportedMediaType, "content type must be application/json")
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return newProblem(http.StatusBadRequest, "request body is empty")
+	}
+
+	body := &io.LimitedReader{R: r.Body, N: MaxBindBodySize + 1}
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(dst)
+	if body.N == 0 {
+		return newProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", MaxBindBodySize))
+	}
+	if err != nil {
+		return jsonProblem(err)
+	}
+	if dec.More() {
+		return newProblem(http.StatusBadRequest, "request body must contain a single JSON value")
+	}
+	return Validate(dst)
+}
+
+func jsonProblem(err error) *Problem {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		maxErr    *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &maxErr):
+		// The body was limited by the MaxBodySize middleware
+		return newProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", maxErr.Limit))
+	case errors.As(err, &syntaxErr):
+		return newProblem(http.StatusBadRequest, fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		p := newProblem(http.StatusBadRequest, "invalid field type")
+		p.Errors = []FieldError{{Field: typeErr.Field, Rule: "type", Message: "must be " + typeErr.Type.String()}}
+		return p
+	case errors.Is(err, io.EOF):
+		return newProblem(http.StatusBadRequest, "request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return newProblem(http.StatusBadRequest, "request body is truncated")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		p := newProblem(http.StatusBadRequest, "unknown field")
+		p.Errors = []FieldError{{Field: field, Rule: "unknown", Message: "is not allowed"}}
+		return p
+	}
+	return newProblem(http.StatusBadRequest, err.Error())
+}
+
+// BindQuery - Sets the fields of dst tagged `query:"name"` from the URL query and validates it
+func BindQuery(r *http.Request, dst interface{}) error {
+	q := r.URL.Query()
+	return bindValues(dst, "query", func(name string) []string { return q[name] })
+}
+
+// BindPath - Sets the fields of dst tagged `path:"name"` from http.ServeMux path wildcards and validates it
+func BindPath(r *http.Request, dst interface{}) error {
+	return bindValues(dst, "path", func(name string) []string {
+		if v := r.PathValue(name); v != "" {
+			return []string{v}
+		}
+		return nil
+	})
+}
+
+func bindValues(dst interface{}, tag string, lookup func(string) []string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind destination must be a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	var errs []FieldError
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get(tag), ",")[0]
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		values := lookup(name)
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), values); err != nil {
+			errs = append(errs, FieldError{Field: name, Rule: "type", Message: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		p := newProblem(http.StatusBadRequest, "invalid "+tag+" parameters")
+		p.Errors = errs
+		return p
+	}
+	return validate(v, tag)
+}
+
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setField(ptr.Elem(), values); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+	if v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setScalar(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setScalar(v, values[0])
+}
+
+func setScalar(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Validate - Checks the `validate` struct tags of v, returning a 422 *Problem listing every failed field.
+// Rules are comma separated: required, min=N, max=N (value for numbers, length otherwise), email,
+// oneof=a b c and regex=pattern, which must come last as the pattern may contain commas.
+// Nested structs, slices and maps of structs are validated recursively.
+func Validate(v interface{}) error {
+	return validate(reflect.ValueOf(v), "json")
+}
+
+func validate(v reflect.Value, nameTag string) error {
+	var errs []FieldError
+	validateValue(v, "", nameTag, &errs)
+	if len(errs) > 0 {
+		p := newProblem(http.StatusUnprocessableEntity, "validation failed")
+		p.Errors = errs
+		return p
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path, nameTag string, errs *[]FieldError) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := fieldName(f, nameTag)
+			if name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			if f.Anonymous && f.Tag.Get(nameTag) == "" {
+				fieldPath = path
+			}
+			fv := v.Field(i)
+			if rules := f.Tag.Get("validate"); rules != "" && rules != "-" {
+				if !checkRules(fv, fieldPath, rules, errs) {
+					continue
+				}
+			}
+			validateValue(fv, fieldPath, nameTag, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), nameTag, errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), nameTag, errs)
+		}
+	}
+}
+
+func fieldName(f reflect.StructField, nameTag string) string {
+	if name := strings.Split(f.Tag.Get(nameTag), ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// checkRules appends the failed rules of a field and reports whether nested validation should continue
+func checkRules(v reflect.Value, path, rules string, errs *[]FieldError) bool {
+	fail := func(rule, msg string) {
+		*errs = append(*errs, FieldError{Field: path, Rule: rule, Message: msg})
+	}
+
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "regex=") {
+			rule, rules = rules, ""
+		} else {
+			rule, rules, _ = strings.Cut(rules, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		if name == "required" {
+			if v.IsZero() {
+				fail(name, "is required")
+				return false
+			}
+			continue
+		}
+		// Other rules don't apply to absent optional values
+		if isNil(v) {
+			return false
+		}
+		value := reflect.Indirect(v)
+
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				fail(name, "invalid rule "+rule)
+				continue
+			}
+			n, unit, ok := measure(value)
+			if !ok {
+				continue
+			}
+			if (name == "min" && n < limit) || (name == "max" && n > limit) {
+				fail(name, boundMessage(name, arg, unit))
+			}
+		case "email":
+			if s, ok := stringOf(value); ok && s != "" {
+				if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+					fail(name, "must be a valid email address")
+				}
+			}
+		case "oneof":
+			if s, ok := stringOf(value); ok {
+				allowed := strings.Fields(arg)
+				if !contains(allowed, s) {
+					fail(name, "must be one of "+strings.Join(allowed, ", "))
+				}
+			}
+		case "regex":
+			re, err := compileRule(arg)
+			if err != nil {
+				fail(name, "invalid rule "+rule)
+				continue
+			}
+			if s, ok := stringOf(value); ok && !re.MatchString(s) {
+				fail(name, "must match "+arg)
+			}
+		default:
+			fail(name, "unknown rule "+name)
+		}
+	}
+	return true
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// measure returns the value of numbers and the length of strings and collections with its unit
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	case reflect.String:
+		return float64(len([]rune(v.String()))), "characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "elements", true
+	}
+	return 0, "", false
+}
+
+func boundMessage(rule, arg, unit string) string {
+	bound := "at least "
+	if rule == "max" {
+		bound = "at most "
+	}
+	if unit == "" {
+		return "must be " + bound + arg
+	}
+	return "must have " + bound + arg + " " + unit
+}
+
+func stringOf(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	}
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var ruleRegexps sync.Map
+
+func compileRule(pattern string) (*regexp.Regexp, error) {
+	if re, ok := ruleRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	ruleRegexps.Store(pattern, re)
+	return re, nil
+}
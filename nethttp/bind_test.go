@@ -0,0 +1,256 @@
+package nethttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bindAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type bindUser struct {
+	Name    string        `json:"name" validate:"required,max=5"`
+	Age     int           `json:"age" validate:"min=18"`
+	Email   string        `json:"email" validate:"email"`
+	Role    string        `json:"role" validate:"oneof=admin user"`
+	Code    *string       `json:"code" validate:"regex=^[a-z]{2,3}$"`
+	Address *bindAddress  `json:"address"`
+	Tags    []string      `json:"tags" validate:"max=2"`
+	Others  []bindAddress `json:"others"`
+}
+
+func TestBindJSON(t *testing.T) {
+	defer func(n int64) { MaxBindBodySize = n }(MaxBindBodySize)
+	MaxBindBodySize = 64
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		errors      []FieldError
+	}{
+		{"valid", "application/json", `{"name":"ann","age":20,"role":"user"}`, 0, nil},
+		{"json suffix", "application/merge-patch+json; charset=utf-8", `{"name":"ann","age":20,"role":"user"}`, 0, nil},
+		{"content type", "text/plain", `{"name":"ann"}`, http.StatusUnsupportedMediaType, nil},
+		{"empty", "application/json", "", http.StatusBadRequest, nil},
+		{"malformed", "application/json", `{"name":}`, http.StatusBadRequest, nil},
+		{"truncated", "application/json", `{"name":"ann"`, http.StatusBadRequest, nil},
+		{"type", "application/json", `{"name":"ann","age":"old"}`, http.StatusBadRequest,
+			[]FieldError{{Field: "age", Rule: "type", Message: "must be int"}}},
+		{"unknown field", "application/json", `{"name":"ann","admin":true}`, http.StatusBadRequest,
+			[]FieldError{{Field: "admin", Rule: "unknown", Message: "is not allowed"}}},
+		{"several values", "application/json", `{"name":"ann","age":20} {}`, http.StatusBadRequest, nil},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge, nil},
+		{"required", "application/json", `{"age":20,"role":"admin"}`, http.StatusUnprocessableEntity,
+			[]FieldError{{Field: "name", Rule: "required", Message: "is required"}}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/users", strings.NewReader(tt.body))
+		if tt.body == "" {
+			r.Body = http.NoBody
+		}
+		r.Header.Set("Content-Type", tt.contentType)
+		var u bindUser
+		err := BindJSON(r, &u)
+		checkProblem(t, tt.name, err, tt.status, tt.errors)
+	}
+}
+
+func TestBindJSONMaxBytesReader(t *testing.T) {
+	var err error
+	h := MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u bindUser
+		err = BindJSON(r, &u)
+	}))
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"ann"}`))
+	r.Header.Set("Content-Type", "application/json")
+	// An unknown length is only caught while reading
+	r.ContentLength = -1
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	checkProblem(t, "MaxBytesReader", err, http.StatusRequestEntityTooLarge, nil)
+}
+
+func checkProblem(t *testing.T, name string, err error, status int, fieldErrors []FieldError) {
+	t.Helper()
+	if status == 0 {
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		return
+	}
+	var p *Problem
+	if !errors.As(err, &p) {
+		t.Errorf("%s: error = %v, want a *Problem", name, err)
+		return
+	}
+	if p.Status != status {
+		t.Errorf("%s: status = %d, want %d (%v)", name, p.Status, status, p)
+	}
+	if fieldErrors != nil && !reflect.DeepEqual(p.Errors, fieldErrors) {
+		t.Errorf("%s: errors = %+v, want %+v", name, p.Errors, fieldErrors)
+	}
+}
+
+func TestBindQuery(t *testing.T) {
+	type query struct {
+		Page   int      `query:"page" validate:"min=1"`
+		Limit  *uint8   `query:"limit"`
+		Active bool     `query:"active"`
+		Score  float64  `query:"score"`
+		IDs    []int64  `query:"id"`
+		Sort   string   `query:"sort" validate:"required,oneof=asc desc"`
+		Skip   string   `query:"-"`
+		Tags   []string `query:"tag"`
+	}
+	tests := []struct {
+		name   string
+		query  string
+		want   query
+		status int
+		errors []FieldError
+	}{
+		{"valid", "page=2&limit=50&active=true&score=1.5&id=1&id=2&sort=asc&tag=a&-=x", query{
+			Page: 2, Limit: func() *uint8 { n := uint8(50); return &n }(), Active: true, Score: 1.5,
+			IDs: []int64{1, 2}, Sort: "asc", Tags: []string{"a"},
+		}, 0, nil},
+		{"conversion", "page=x&limit=300&active=maybe&score=y&id=1&id=z&sort=asc", query{}, http.StatusBadRequest, []FieldError{
+			{Field: "page", Rule: "type", Message: "must be an integer"},
+			{Field: "limit", Rule: "type", Message: "must be a positive integer"},
+			{Field: "active", Rule: "type", Message: "must be a boolean"},
+			{Field: "score", Rule: "type", Message: "must be a number"},
+			{Field: "id", Rule: "type", Message: "must be an integer"},
+		}},
+		{"validation", "page=0", query{}, http.StatusUnprocessableEntity, []FieldError{
+			{Field: "page", Rule: "min", Message: "must be at least 1"},
+			{Field: "sort", Rule: "required", Message: "is required"},
+		}},
+	}
+	for _, tt := range tests {
+		var q query
+		err := BindQuery(httptest.NewRequest("GET", "/?"+tt.query, nil), &q)
+		checkProblem(t, tt.name, err, tt.status, tt.errors)
+		if tt.status == 0 && !reflect.DeepEqual(q, tt.want) {
+			t.Errorf("%s: BindQuery = %+v, want %+v", tt.name, q, tt.want)
+		}
+	}
+
+	if err := BindQuery(httptest.NewRequest("GET", "/", nil), &struct{ Page chan int }{}); err != nil {
+		t.Errorf("untagged field: %v", err)
+	}
+	if err := BindQuery(httptest.NewRequest("GET", "/", nil), query{}); err == nil {
+		t.Error("non pointer destination accepted")
+	}
+}
+
+func TestBindPath(t *testing.T) {
+	type params struct {
+		ID   int    `path:"id"`
+		Slug string `path:"slug" validate:"required"`
+	}
+	var (
+		got params
+		err error
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /posts/{id}/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		got = params{}
+		err = BindPath(r, &got)
+	})
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/posts/7/hello", nil))
+	if err != nil || got != (params{ID: 7, Slug: "hello"}) {
+		t.Errorf("BindPath = %+v, %v", got, err)
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/posts/seven/hello", nil))
+	checkProblem(t, "path type", err, http.StatusBadRequest, []FieldError{{Field: "id", Rule: "type", Message: "must be an integer"}})
+}
+
+func TestValidate(t *testing.T) {
+	code := "abcd"
+	u := bindUser{
+		Name:    "annabel",
+		Age:     12,
+		Email:   "Ann <ann@example.com>",
+		Role:    "root",
+		Code:    &code,
+		Address: &bindAddress{},
+		Tags:    []string{"a", "b", "c"},
+		Others:  []bindAddress{{City: "Paris"}, {}},
+	}
+	err := Validate(&u)
+	checkProblem(t, "validate", err, http.StatusUnprocessableEntity, []FieldError{
+		{Field: "name", Rule: "max", Message: "must have at most 5 characters"},
+		{Field: "age", Rule: "min", Message: "must be at least 18"},
+		{Field: "email", Rule: "email", Message: "must be a valid email address"},
+		{Field: "role", Rule: "oneof", Message: "must be one of admin, user"},
+		{Field: "code", Rule: "regex", Message: "must match ^[a-z]{2,3}$"},
+		{Field: "address.city", Rule: "required", Message: "is required"},
+		{Field: "tags", Rule: "max", Message: "must have at most 2 elements"},
+		{Field: "others[1].city", Rule: "required", Message: "is required"},
+	})
+
+	// Nil pointers and slices skip every rule but required
+	if err := Validate(&bindUser{Name: "ann", Age: 18, Role: "user"}); err != nil {
+		t.Errorf("Validate minimal user = %v", err)
+	}
+	type bad struct {
+		N int `validate:"min=x,frobnicate"`
+	}
+	checkProblem(t, "invalid rules", Validate(bad{}), http.StatusUnprocessableEntity, []FieldError{
+		{Field: "N", Rule: "min", Message: "invalid rule min=x"},
+		{Field: "N", Rule: "frobnicate", Message: "unknown rule frobnicate"},
+	})
+}
+
+func TestWriteProblem(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		title  string
+	}{
+		{"problem", &Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "no such order"}, http.StatusNotFound, "Not Found"},
+		{"wrapped problem", fmt.Errorf("binding: %w", newProblem(http.StatusConflict, "")), http.StatusConflict, "Conflict"},
+		{"other error", errors.New("database is down"), http.StatusInternalServerError, "Internal Server Error"},
+		{"zero status", &Problem{Detail: "oops"}, http.StatusInternalServerError, "Internal Server Error"},
+		{"zero status with field errors", &Problem{Errors: []FieldError{{Field: "id", Rule: "type"}}}, http.StatusBadRequest, "Bad Request"},
+		{"invalid status", &Problem{Title: "Weird", Status: 42}, http.StatusInternalServerError, "Weird"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		WriteProblem(w, httptest.NewRequest("GET", "/orders/1", nil), tt.err)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s: Content-Type = %s", tt.name, ct)
+		}
+		var p Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if p.Status != tt.status || p.Title != tt.title || p.Instance != "/orders/1" {
+			t.Errorf("%s: problem = %+v", tt.name, p)
+		}
+	}
+
+	// The error passed in is not modified
+	p := &Problem{Status: http.StatusBadRequest}
+	WriteProblem(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), p)
+	if p.Instance != "" || p.Title != "" {
+		t.Errorf("WriteProblem modified the problem: %+v", p)
+	}
+	w := httptest.NewRecorder()
+	WriteProblem(w, nil, newProblem(http.StatusTeapot, "short and stout"))
+	if !strings.Contains(w.Body.String(), `"detail":"short and stout"`) || strings.Contains(w.Body.String(), "instance") {
+		t.Errorf("WriteProblem without request = %s", w.Body)
+	}
+}
@@ -0,0 +1,531 @@
+package nethttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStore - Storage of a CachingTransport, implemented by NewMemoryCacheStore and redis.NewHTTPCacheStore
+type CacheStore interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// SharedCacheStore - Implemented by stores shared between processes, such as redis.NewHTTPCacheStore.
+// NewCachingTransport enables CachingTransport.Shared for them.
+type SharedCacheStore interface {
+	CacheStore
+	SharedCache() bool
+}
+
+type memoryCacheStore struct {
+	lru *lruCache
+}
+
+// NewMemoryCacheStore - In-memory LRU CacheStore holding up to size responses
+func NewMemoryCacheStore(size int) CacheStore {
+	return &memoryCacheStore{lru: newLRUCache(size)}
+}
+
+func (s *memoryCacheStore) Get(key string) ([]byte, bool, error) {
+	v, ok := s.lru.get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return v.([]byte), true, nil
+}
+
+func (s *memoryCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.lru.add(key, value, ttl)
+	return nil
+}
+
+func (s *memoryCacheStore) Delete(key string) error {
+	s.lru.remove(key)
+	return nil
+}
+
+// Values of the X-Cache header added to responses returned by a CachingTransport
+const (
+	CacheHit         = "HIT"
+	CacheMiss        = "MISS"
+	CacheStale       = "STALE"
+	CacheRevalidated = "REVALIDATED"
+)
+
+// CacheStatusHeader - Response header reporting how a CachingTransport served the response
+const CacheStatusHeader = "X-Cache"
+
+// CachingTransport - RoundTripper caching GET responses following RFC 9111.
+// Supports Cache-Control freshness, ETag and Last-Modified revalidation, Vary,
+// stale-while-revalidate and stale-if-error.
+type CachingTransport struct {
+	Transport http.RoundTripper // nil uses http.DefaultTransport
+	Store     CacheStore
+
+	// Shared makes the cache behave as a shared cache: s-maxage applies and
+	// private or authorized responses are not stored. A private cache keeps the
+	// responses to requests with credentials apart per Authorization and Cookie.
+	Shared bool
+	// MaxBodySize is the largest response body that is cached, default 1MB
+	MaxBodySize int64
+	// RevalidateTTL is how long stale responses with validators are kept for revalidation, default 24h
+	RevalidateTTL time.Duration
+
+	inflight sync.Map
+}
+
+// NewCachingTransport - Creates a CachingTransport on top of next, nil uses http.DefaultTransport.
+// The cache is shared when the store implements SharedCacheStore.
+func NewCachingTransport(store CacheStore, next http.RoundTripper) *CachingTransport {
+	t := &CachingTransport{
+		Transport:     next,
+		Store:         store,
+		MaxBodySize:   1 << 20,
+		RevalidateTTL: 24 * time.Hour,
+	}
+	if shared, ok := store.(SharedCacheStore); ok {
+		t.Shared = shared.SharedCache()
+	}
+	return t
+}
+
+// cacheEntry is the stored form of a response, or of the Vary header names of a URL
+type cacheEntry struct {
+	Status    int         `json:"status,omitempty"`
+	Header    http.Header `json:"header,omitempty"`
+	Body      []byte      `json:"body,omitempty"`
+	Stored    time.Time   `json:"stored"`
+	VaryNames []string    `json:"vary,omitempty"`
+}
+
+func (t *CachingTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip - Serves fresh responses from the store, revalidates stale ones and stores cacheable responses
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		resp, err := t.transport().RoundTrip(req)
+		if err == nil && isUnsafeMethod(req.Method) && resp.StatusCode < 400 {
+			// RFC 9111 4.4, a successful unsafe request invalidates the target URI
+			t.Store.Delete(primaryCacheKey(req))
+			if key := t.primaryKey(req); key != primaryCacheKey(req) {
+				t.Store.Delete(key)
+			}
+		}
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") || req.Header.Get("Range") != "" ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.transport().RoundTrip(req)
+	}
+
+	entry, key := t.lookup(req)
+	if entry == nil {
+		if reqCC.has("only-if-cached") {
+			return gatewayTimeout(req), nil
+		}
+		resp, err := t.transport().RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return t.store(req, resp, CacheMiss)
+	}
+
+	resCC := parseCacheControl(entry.Header)
+	age := entry.age()
+	lifetime := freshnessLifetime(entry, resCC, t.Shared)
+	if maxAge, ok := reqCC.duration("max-age"); ok && maxAge < lifetime {
+		lifetime = maxAge
+	}
+	if minFresh, ok := reqCC.duration("min-fresh"); ok {
+		lifetime -= minFresh
+	}
+
+	noCache := reqCC.has("no-cache") || resCC.has("no-cache")
+	if !noCache && age < lifetime {
+		return entry.response(req, CacheHit), nil
+	}
+	if reqCC.has("only-if-cached") {
+		return entry.response(req, CacheStale), nil
+	}
+
+	staleFor := age - lifetime
+	mustRevalidate := resCC.has("must-revalidate") || (t.Shared && resCC.has("proxy-revalidate"))
+	if swr, ok := resCC.duration("stale-while-revalidate"); ok && !noCache && !mustRevalidate && staleFor < swr {
+		resp := entry.response(req, CacheStale)
+		// The background revalidation refreshes its own copy of the entry
+		t.revalidateAsync(req, key, entry.clone())
+		return resp, nil
+	}
+
+	resp, err := t.transport().RoundTrip(conditionalRequest(req, entry))
+	if err != nil {
+		if canServeStaleOnError(resCC, staleFor, mustRevalidate) {
+			return entry.response(req, CacheStale), nil
+		}
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		entry.refresh(resp)
+		t.save(req, entry)
+		return entry.response(req, CacheRevalidated), nil
+	}
+	if resp.StatusCode >= 500 && canServeStaleOnError(resCC, staleFor, mustRevalidate) {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return entry.response(req, CacheStale), nil
+	}
+	return t.store(req, resp, CacheMiss)
+}
+
+// lookup returns the stored response matching the request and its key
+func (t *CachingTransport) lookup(req *http.Request) (*cacheEntry, string) {
+	key := t.primaryKey(req)
+	entry := t.load(key)
+	if entry == nil || len(entry.VaryNames) == 0 {
+		return entry, key
+	}
+	key = variantCacheKey(key, entry.VaryNames, req.Header)
+	return t.load(key), key
+}
+
+func (t *CachingTransport) load(key string) *cacheEntry {
+	data, ok, err := t.Store.Get(key)
+	if err != nil || !ok {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// store caches resp when allowed and returns a response with a readable body
+func (t *CachingTransport) store(req *http.Request, resp *http.Response, status string) (*http.Response, error) {
+	resp.Header.Set(CacheStatusHeader, status)
+	if !t.cacheable(req, resp) {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, t.MaxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > t.MaxBodySize {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+
+	header := resp.Header.Clone()
+	header.Del(CacheStatusHeader)
+	entry := &cacheEntry{
+		Status: resp.StatusCode,
+		Header: header,
+		Body:   body,
+		Stored: time.Now(),
+	}
+	t.save(req, entry)
+	return resp, nil
+}
+
+// save writes the entry, and the Vary index when the response varies on request headers
+func (t *CachingTransport) save(req *http.Request, entry *cacheEntry) {
+	resCC := parseCacheControl(entry.Header)
+	ttl := freshnessLifetime(entry, resCC, t.Shared)
+	stale := time.Duration(0)
+	if d, ok := resCC.duration("stale-while-revalidate"); ok {
+		stale = d
+	}
+	if d, ok := resCC.duration("stale-if-error"); ok && d > stale {
+		stale = d
+	}
+	ttl += stale
+	if entry.Header.Get("ETag") != "" || entry.Header.Get("Last-Modified") != "" {
+		ttl += t.RevalidateTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	// Store failures only cost a cache miss
+	key := t.primaryKey(req)
+	if vary := varyNames(entry.Header); len(vary) > 0 {
+		index, _ := json.Marshal(cacheEntry{Stored: entry.Stored, VaryNames: vary})
+		t.Store.Set(key, index, ttl)
+		key = variantCacheKey(key, vary, req.Header)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	t.Store.Set(key, data, ttl)
+}
+
+// cacheable reports whether RFC 9111 section 3 allows storing the response
+func (t *CachingTransport) cacheable(req *http.Request, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+	default:
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || resp.Header.Get("Vary") == "*" {
+		return false
+	}
+	if t.Shared {
+		if cc.has("private") {
+			return false
+		}
+		if req.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+			return false
+		}
+	}
+	return cc.has("max-age") || cc.has("s-maxage") || resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "" || cc.has("public")
+}
+
+// revalidateAsync refreshes a stale entry in the background, once per key at a time
+func (t *CachingTransport) revalidateAsync(req *http.Request, key string, entry *cacheEntry) {
+	if _, running := t.inflight.LoadOrStore(key, true); running {
+		return
+	}
+	bgReq := req.Clone(context.Background())
+	go func() {
+		defer t.inflight.Delete(key)
+		resp, err := t.transport().RoundTrip(conditionalRequest(bgReq, entry))
+		if err != nil {
+			return
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			entry.refresh(resp)
+			t.save(bgReq, entry)
+			return
+		}
+		if resp, err = t.store(bgReq, resp, CacheMiss); err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+}
+
+// conditionalRequest adds the validators of entry to a copy of req
+func conditionalRequest(req *http.Request, entry *cacheEntry) *http.Request {
+	cond := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		cond.Header.Set("If-Modified-Since", lastModified)
+	}
+	return cond
+}
+
+// refresh updates a stored response with the headers of a 304 response
+func (e *cacheEntry) refresh(notModified *http.Response) {
+	for k, v := range notModified.Header {
+		switch k {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", CacheStatusHeader:
+			continue
+		}
+		e.Header[k] = v
+	}
+	e.Header.Del("Age")
+	e.Stored = time.Now()
+}
+
+// clone copies the entry so it can be refreshed while responses built from it are read
+func (e *cacheEntry) clone() *cacheEntry {
+	c := *e
+	c.Header = e.Header.Clone()
+	return &c
+}
+
+// age is the current age of the stored response (RFC 9111 4.2.3, simplified)
+func (e *cacheEntry) age() time.Duration {
+	age := time.Since(e.Stored)
+	if v, err := strconv.Atoi(e.Header.Get("Age")); err == nil && v > 0 {
+		age += time.Duration(v) * time.Second
+	}
+	return age
+}
+
+// response rebuilds an http.Response from the stored entry
+func (e *cacheEntry) response(req *http.Request, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(e.age().Seconds())))
+	header.Set(CacheStatusHeader, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// freshnessLifetime implements RFC 9111 4.2.1 with the 10% Last-Modified heuristic
+func freshnessLifetime(e *cacheEntry, cc cacheControl, shared bool) time.Duration {
+	if shared {
+		if d, ok := cc.duration("s-maxage"); ok {
+			return d
+		}
+	}
+	if d, ok := cc.duration("max-age"); ok {
+		return d
+	}
+
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.Stored
+	}
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return t.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil {
+		heuristic := date.Sub(lastModified) / 10
+		if heuristic > 24*time.Hour {
+			heuristic = 24 * time.Hour
+		}
+		if heuristic > 0 {
+			return heuristic
+		}
+	}
+	return 0
+}
+
+func canServeStaleOnError(cc cacheControl, staleFor time.Duration, mustRevalidate bool) bool {
+	sie, ok := cc.duration("stale-if-error")
+	return ok && !mustRevalidate && staleFor < sie
+}
+
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 Gateway Timeout",
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{CacheStatusHeader: []string{CacheMiss}},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+}
+
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+func primaryCacheKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(http.MethodGet + " " + req.URL.String()))
+	return "nethttp:cache:" + hex.EncodeToString(sum[:])
+}
+
+// primaryKey is the key of req, a private cache partitions it by the credentials of the request
+func (t *CachingTransport) primaryKey(req *http.Request) string {
+	key := primaryCacheKey(req)
+	if t.Shared {
+		return key
+	}
+	auth, cookie := req.Header.Get("Authorization"), req.Header.Get("Cookie")
+	if auth == "" && cookie == "" {
+		return key
+	}
+	sum := sha256.Sum256([]byte(auth + "\n" + cookie))
+	return key + ":user:" + hex.EncodeToString(sum[:])
+}
+
+func variantCacheKey(primary string, names []string, h http.Header) string {
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s:%s\n", name, strings.Join(h.Values(name), ","))
+	}
+	return primary + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// cacheControl holds parsed Cache-Control directives
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) duration(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
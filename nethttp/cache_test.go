@@ -0,0 +1,121 @@
+package nethttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type sharedTestStore struct {
+	CacheStore
+}
+
+func (sharedTestStore) SharedCache() bool { return true }
+
+func cachedGet(t *testing.T, client *http.Client, url string, header map[string]string) (string, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), resp.Header.Get(CacheStatusHeader)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestCachingTransportStaleWhileRevalidate(t *testing.T) {
+	var requests atomic.Int32
+	origin := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		rec := httptest.NewRecorder()
+		rec.Header().Set("ETag", `"v1"`)
+		rec.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		rec.Header().Set("X-Revalidated", strconv.Itoa(int(requests.Load())))
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			rec.WriteHeader(http.StatusNotModified)
+		} else {
+			io.WriteString(rec, "body")
+		}
+		return rec.Result(), nil
+	})
+
+	client := &http.Client{Transport: NewCachingTransport(NewMemoryCacheStore(10), origin)}
+	if body, status := cachedGet(t, client, "http://example.com/", nil); body != "body" || status != CacheMiss {
+		t.Fatalf("first response = %q %s", body, status)
+	}
+
+	// Stale responses are served while revalidations refresh the entry, run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if body, _ := cachedGet(t, client, "http://example.com/", nil); body != "body" {
+					t.Errorf("stale response body = %q", body)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// Revalidations run in the background
+	deadline := time.Now().Add(time.Second)
+	for requests.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := requests.Load(); n < 2 {
+		t.Errorf("origin requests = %d, want revalidations", n)
+	}
+}
+
+func TestCachingTransportSharedStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	transport := NewCachingTransport(sharedTestStore{NewMemoryCacheStore(10)}, nil)
+	if !transport.Shared {
+		t.Fatal("a SharedCacheStore should make the transport shared")
+	}
+	client := &http.Client{Transport: transport}
+	cachedGet(t, client, srv.URL, map[string]string{"Authorization": "Bearer alice"})
+	if body, status := cachedGet(t, client, srv.URL, map[string]string{"Authorization": "Bearer bob"}); body != "Bearer bob" || status != CacheMiss {
+		t.Errorf("shared cache served %q %s to another caller", body, status)
+	}
+}
+
+func TestCachingTransportPrivateKeysByCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewCachingTransport(NewMemoryCacheStore(10), nil)}
+	alice := map[string]string{"Authorization": "Bearer alice"}
+	cachedGet(t, client, srv.URL, alice)
+	if body, status := cachedGet(t, client, srv.URL, alice); body != "Bearer alice" || status != CacheHit {
+		t.Errorf("second request = %q %s, want a hit", body, status)
+	}
+	if body, status := cachedGet(t, client, srv.URL, map[string]string{"Authorization": "Bearer bob"}); body != "Bearer bob" || status != CacheMiss {
+		t.Errorf("private cache served %q %s to another caller", body, status)
+	}
+	if body, status := cachedGet(t, client, srv.URL, nil); body != "" || status != CacheMiss {
+		t.Errorf("private cache served %q %s to an anonymous caller", body, status)
+	}
+}
@@ -0,0 +1,224 @@
+package nethttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// ForwardingHeader - Header through which the trusted proxies pass on the client address
+type ForwardingHeader int
+
+const (
+	// XForwardedFor - Comma separated X-Forwarded-For hops, appended to by most proxies
+	XForwardedFor ForwardingHeader = iota
+	// Forwarded - RFC 7239 Forwarded elements, only for proxies that append to it
+	Forwarded
+	// XRealIP - Single X-Real-Ip address, only for proxies that overwrite it
+	XRealIP
+)
+
+func (h ForwardingHeader) String() string {
+	switch h {
+	case XForwardedFor:
+		return "X-Forwarded-For"
+	case Forwarded:
+		return "Forwarded"
+	case XRealIP:
+		return "X-Real-Ip"
+	}
+	return fmt.Sprintf("ForwardingHeader(%d)", int(h))
+}
+
+// IPResolver - Resolves the client IP address of a request that may have passed through trusted proxies
+type IPResolver struct {
+	header  ForwardingHeader
+	trusted []netip.Prefix
+}
+
+// defaultIPResolver - Resolver used by GetIPFromReq, replaced by SetTrustedProxies while requests are served
+var defaultIPResolver atomic.Pointer[IPResolver]
+
+func init() {
+	defaultIPResolver.Store(MustIPResolver(XForwardedFor,
+		"127.0.0.0/8",
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::1/128",
+		"fc00::/7",
+	))
+}
+
+// DefaultIPResolver - Returns the resolver used by GetIPFromReq, by default it trusts the
+// X-Forwarded-For hops added by loopback and private network proxies
+func DefaultIPResolver() *IPResolver {
+	return defaultIPResolver.Load()
+}
+
+// NewIPResolver - Creates a resolver that trusts proxies within the given CIDRs or single addresses.
+// Only header is read, the others can be set by the client and pass through the proxies unchanged.
+func NewIPResolver(header ForwardingHeader, trustedProxies ...string) (*IPResolver, error) {
+	if header < XForwardedFor || header > XRealIP {
+		return nil, fmt.Errorf("invalid forwarding header %v", header)
+	}
+	res := &IPResolver{header: header}
+	for _, p := range trustedProxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s: %v", p, err)
+			}
+			addr = addr.Unmap().WithZone("")
+			res.trusted = append(res.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %v", p, err)
+		}
+		res.trusted = append(res.trusted, prefix.Masked())
+	}
+	return res, nil
+}
+
+// MustIPResolver - Same as NewIPResolver but panics on invalid input
+func MustIPResolver(header ForwardingHeader, trustedProxies ...string) *IPResolver {
+	res, err := NewIPResolver(header, trustedProxies...)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// SetTrustedProxies - Replaces the proxies and header trusted by GetIPFromReq, safe to call while serving requests
+func SetTrustedProxies(header ForwardingHeader, trustedProxies ...string) error {
+	res, err := NewIPResolver(header, trustedProxies...)
+	if err != nil {
+		return err
+	}
+	defaultIPResolver.Store(res)
+	return nil
+}
+
+// IsTrusted - Checks if the address belongs to a trusted proxy
+func (res *IPResolver) IsTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve - Returns the client address of the request.
+// The peer address is used unless it is a trusted proxy, in which case the hops of
+// the resolver's header are walked right-to-left and the first hop that is not a
+// trusted proxy is returned. Other forwarding headers are never consulted.
+func (res *IPResolver) Resolve(r *http.Request) (netip.Addr, error) {
+	remote, err := parseHostAddr(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid remote address %s: %v", r.RemoteAddr, err)
+	}
+	if !res.IsTrusted(remote) {
+		return remote, nil
+	}
+
+	var chain []string
+	switch res.header {
+	case Forwarded:
+		chain = forwardedChain(r.Header)
+	case XRealIP:
+		// Proxies overwrite X-Real-Ip, so only the last value counts
+		if values := r.Header.Values("X-Real-Ip"); len(values) > 0 {
+			chain = values[len(values)-1:]
+		}
+	default:
+		chain = xForwardedForChain(r.Header)
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := parseHostAddr(chain[i])
+		if err != nil {
+			// Anything left of a malformed or obfuscated hop can't be trusted
+			return client, nil
+		}
+		client = addr
+		if !res.IsTrusted(addr) {
+			return addr, nil
+		}
+	}
+	return client, nil
+}
+
+// forwardedChain returns the for= values of all Forwarded header elements in order
+func forwardedChain(h http.Header) []string {
+	var chain []string
+	for _, v := range h.Values("Forwarded") {
+		for _, element := range splitQuoted(v, ',') {
+			node := ""
+			for _, pair := range splitQuoted(element, ';') {
+				k, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(strings.TrimSpace(k), "for") {
+					continue
+				}
+				node = strings.Trim(strings.TrimSpace(val), `"`)
+			}
+			chain = append(chain, node)
+		}
+	}
+	return chain
+}
+
+// xForwardedForChain returns all X-Forwarded-For hops in order
+func xForwardedForChain(h http.Header) []string {
+	var chain []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			chain = append(chain, strings.TrimSpace(hop))
+		}
+	}
+	return chain
+}
+
+// splitQuoted splits s on sep, ignoring separators inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseHostAddr parses an IPv4 or IPv6 address with an optional port or brackets
+func parseHostAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	} else {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap().WithZone(""), nil
+}
@@ -0,0 +1,109 @@
+package nethttp
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPResolverResolve(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "2001:db8:ffff::/48", "fe80::/10"}
+	tests := []struct {
+		name    string
+		header  ForwardingHeader
+		remote  string
+		headers map[string][]string
+		want    string
+	}{
+		{"untrusted peer", XForwardedFor, "198.51.100.7:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9"}}, "198.51.100.7"},
+		{"no header", XForwardedFor, "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"x-forwarded-for", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9"}}, "203.0.113.9"},
+		{"spoofed x-forwarded-for hop", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"6.6.6.6, 203.0.113.9"}}, "203.0.113.9"},
+		{"trusted hops", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"6.6.6.6, 203.0.113.9", "10.0.0.3, 10.0.0.2"}}, "203.0.113.9"},
+		{"only trusted hops", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"malformed hop", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"6.6.6.6, garbage, 10.0.0.2"}}, "10.0.0.2"},
+		{"spoofed forwarded ignored", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=6.6.6.6"}, "X-Forwarded-For": {"203.0.113.9"}}, "203.0.113.9"},
+		{"spoofed x-real-ip ignored", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"X-Real-Ip": {"6.6.6.6"}}, "10.0.0.1"},
+		{"forwarded", Forwarded, "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {`for=6.6.6.6, for=203.0.113.9;proto=https, for="10.0.0.2"`}}, "203.0.113.9"},
+		{"spoofed x-forwarded-for ignored", Forwarded, "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"6.6.6.6"}}, "10.0.0.1"},
+		{"forwarded ipv6", Forwarded, "[2001:db8:ffff::1]:443",
+			map[string][]string{"Forwarded": {`for="[2001:db8::7]:4711"`}}, "2001:db8::7"},
+		{"obfuscated identifier", Forwarded, "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=203.0.113.9, for=_hidden, for=10.0.0.2"}}, "10.0.0.2"},
+		{"unknown identifier", Forwarded, "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{"x-real-ip", XRealIP, "10.0.0.1:1234",
+			map[string][]string{"X-Real-Ip": {"6.6.6.6", "203.0.113.9"}}, "203.0.113.9"},
+		{"spoofed forwarded ignored by x-real-ip", XRealIP, "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=6.6.6.6"}}, "10.0.0.1"},
+		{"ipv6 hop", XForwardedFor, "[2001:db8:ffff::1]:443",
+			map[string][]string{"X-Forwarded-For": {"2001:db8::7"}}, "2001:db8::7"},
+		{"ipv4 mapped peer", XForwardedFor, "[::ffff:10.0.0.1]:443",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9"}}, "203.0.113.9"},
+		{"zoned peer", XForwardedFor, "[fe80::1%eth0]:443",
+			map[string][]string{"X-Forwarded-For": {"fe80::2%eth1, 203.0.113.9"}}, "203.0.113.9"},
+		{"zoned hop", XForwardedFor, "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"fe80::2%eth1"}}, "fe80::2"},
+	}
+	for _, tt := range tests {
+		res := MustIPResolver(tt.header, trusted...)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for k, values := range tt.headers {
+			for _, v := range values {
+				r.Header.Add(k, v)
+			}
+		}
+		addr, err := res.Resolve(r)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if addr.String() != tt.want {
+			t.Errorf("%s: Resolve = %s, want %s", tt.name, addr, tt.want)
+		}
+	}
+}
+
+func TestNewIPResolverErrors(t *testing.T) {
+	if _, err := NewIPResolver(XForwardedFor, "10.0.0.0/33"); err == nil {
+		t.Error("invalid prefix accepted")
+	}
+	if _, err := NewIPResolver(XForwardedFor, "not an address"); err == nil {
+		t.Error("invalid address accepted")
+	}
+	if _, err := NewIPResolver(ForwardingHeader(7)); err == nil {
+		t.Error("invalid header accepted")
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "nonsense"
+	if _, err := MustIPResolver(XForwardedFor).Resolve(r); err == nil {
+		t.Error("invalid remote address accepted")
+	}
+}
+
+func TestGetIPFromReq(t *testing.T) {
+	defer defaultIPResolver.Store(DefaultIPResolver())
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.168.1.1:1234"
+	r.Header.Set("Forwarded", "for=6.6.6.6")
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if ip := GetIPFromReq(r); ip != "203.0.113.9" {
+		t.Errorf("GetIPFromReq = %s, want 203.0.113.9", ip)
+	}
+	if err := SetTrustedProxies(Forwarded, "192.168.0.0/16"); err != nil {
+		t.Fatal(err)
+	}
+	if ip := GetIPFromReq(r); ip != "6.6.6.6" {
+		t.Errorf("GetIPFromReq after SetTrustedProxies = %s, want 6.6.6.6", ip)
+	}
+}
@@ -0,0 +1,296 @@
+package nethttp
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	maxminddb "github.com/oschwald/maxminddb-golang"
+)
+
+// GeoLocation - Location and network details of an IP address
+type GeoLocation struct {
+	IP           string `json:"ip"`
+	Country      string `json:"country,omitempty"`
+	CountryCode  string `json:"countryCode,omitempty"`
+	City         string `json:"city,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	ISP          string `json:"isp,omitempty"`
+}
+
+// String - Human readable location, e.g. "Berlin, Germany (Deutsche Telekom AG)"
+func (l GeoLocation) String() string {
+	loc := l.Country
+	if l.City != "" && loc != "" {
+		loc = l.City + ", " + loc
+	}
+	isp := l.ISP
+	if isp == "" {
+		isp = l.Organization
+	}
+	switch {
+	case loc == "" && isp == "":
+		return "Unknown location"
+	case loc == "":
+		return isp
+	case isp == "":
+		return loc
+	}
+	return loc + " (" + isp + ")"
+}
+
+// mmdbRecord covers the fields of the GeoIP2/GeoLite2 City, Country, ASN and ISP databases
+type mmdbRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	ASOrg        string `maxminddb:"autonomous_system_organization"`
+	ISP          string `maxminddb:"isp"`
+	Organization string `maxminddb:"organization"`
+}
+
+type geoDB struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+}
+
+// GeoIP - Offline GeoIP lookups backed by MaxMind (MMDB) database files.
+// Databases are reopened when the files change on disk and lookups are cached in memory.
+type GeoIP struct {
+	mu    sync.RWMutex
+	dbs   []*geoDB
+	cache *lruCache
+	ttl   time.Duration
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// geoIPDB - Database used by GetISPLocationFromReq, replaced by InitGeoIP while requests are served
+var geoIPDB atomic.Pointer[GeoIP]
+
+// GeoIPDB - Returns the database used by GetISPLocationFromReq, nil until InitGeoIP is called
+func GeoIPDB() *GeoIP {
+	return geoIPDB.Load()
+}
+
+// InitGeoIP - Opens the MMDB files used by GetISPLocationFromReq and reloads them every minute when changed.
+// It may be called again while serving requests, the previous databases are closed.
+func InitGeoIP(paths ...string) error {
+	g, err := NewGeoIP(paths...)
+	if err != nil {
+		return err
+	}
+	g.WatchReload(time.Minute)
+	if old := geoIPDB.Swap(g); old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// NewGeoIP - Opens one or more MMDB files, e.g. a City database and an ASN or ISP database
+func NewGeoIP(paths ...string) (*GeoIP, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no geoip database given")
+	}
+	g := &GeoIP{
+		cache: newLRUCache(10000),
+		ttl:   time.Hour,
+		stop:  make(chan struct{}),
+	}
+	for _, p := range paths {
+		db, err := openGeoDB(p)
+		if err != nil {
+			g.closeDBs()
+			return nil, err
+		}
+		g.dbs = append(g.dbs, db)
+	}
+	return g, nil
+}
+
+func openGeoDB(path string) (*geoDB, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening geoip database %s: %v", path, err)
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening geoip database %s: %v", path, err)
+	}
+	return &geoDB{path: path, reader: reader, modTime: info.ModTime()}, nil
+}
+
+// SetCache - Sets the lookup cache size and ttl, a size of 0 disables caching
+func (g *GeoIP) SetCache(size int, ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if size <= 0 {
+		g.cache = nil
+		return
+	}
+	g.cache = newLRUCache(size)
+	g.ttl = ttl
+}
+
+// Lookup - Looks up the location of an address in all databases
+func (g *GeoIP) Lookup(addr netip.Addr) (GeoLocation, error) {
+	addr = addr.Unmap().WithZone("")
+	key := addr.String()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.cache != nil {
+		if loc, ok := g.cache.get(key); ok {
+			return loc.(GeoLocation), nil
+		}
+	}
+
+	loc := GeoLocation{IP: key}
+	if g.dbs == nil {
+		return loc, errGeoIPClosed
+	}
+	for _, db := range g.dbs {
+		var rec mmdbRecord
+		if err := db.reader.Lookup(addr.AsSlice(), &rec); err != nil {
+			return loc, fmt.Errorf("error looking up %s in %s: %v", key, db.path, err)
+		}
+		if name := rec.Country.Names["en"]; name != "" {
+			loc.Country = name
+		}
+		if rec.Country.ISOCode != "" {
+			loc.CountryCode = rec.Country.ISOCode
+		}
+		if name := rec.City.Names["en"]; name != "" {
+			loc.City = name
+		}
+		if rec.ASN != 0 {
+			loc.ASN = rec.ASN
+		}
+		if rec.ASOrg != "" {
+			loc.Organization = rec.ASOrg
+		}
+		if rec.Organization != "" {
+			loc.Organization = rec.Organization
+		}
+		if rec.ISP != "" {
+			loc.ISP = rec.ISP
+		}
+	}
+
+	if g.cache != nil {
+		g.cache.add(key, loc, g.ttl)
+	}
+	return loc, nil
+}
+
+// Reload - Reopens the database files that changed on disk since they were loaded
+func (g *GeoIP) Reload() error {
+	g.mu.RLock()
+	if g.dbs == nil {
+		g.mu.RUnlock()
+		return errGeoIPClosed
+	}
+	changed := make(map[int]*geoDB)
+	for i, db := range g.dbs {
+		info, err := os.Stat(db.path)
+		if err != nil {
+			g.mu.RUnlock()
+			return fmt.Errorf("error checking geoip database %s: %v", db.path, err)
+		}
+		if !info.ModTime().Equal(db.modTime) {
+			changed[i] = db
+		}
+	}
+	g.mu.RUnlock()
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	fresh := make(map[int]*geoDB, len(changed))
+	for i, stale := range changed {
+		db, err := openGeoDB(stale.path)
+		if err != nil {
+			for _, opened := range fresh {
+				opened.reader.Close()
+			}
+			return err
+		}
+		fresh[i] = db
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.dbs == nil {
+		// Closed while the files were being opened
+		for _, db := range fresh {
+			db.reader.Close()
+		}
+		return errGeoIPClosed
+	}
+	for i, db := range fresh {
+		if g.dbs[i] != changed[i] {
+			// A concurrent Reload already replaced it
+			db.reader.Close()
+			continue
+		}
+		g.dbs[i].reader.Close()
+		g.dbs[i] = db
+	}
+	if g.cache != nil {
+		g.cache.purge()
+	}
+	return nil
+}
+
+// WatchReload - Checks the database files for changes at the given interval until Close is called
+func (g *GeoIP) WatchReload(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-ticker.C:
+				// A failed reload keeps serving the previously loaded databases
+				_ = g.Reload()
+			}
+		}
+	}()
+}
+
+// Close - Stops reloading and closes the databases
+func (g *GeoIP) Close() error {
+	g.once.Do(func() { close(g.stop) })
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closeDBs()
+}
+
+var errGeoIPClosed = errors.New("geoip database is closed")
+
+func (g *GeoIP) closeDBs() error {
+	var err error
+	for _, db := range g.dbs {
+		if cerr := db.reader.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	g.dbs = nil
+	return err
+}
@@ -0,0 +1,180 @@
+package nethttp
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The test databases are generated by testdata/gen_geoip.go
+const (
+	testCityDB = "testdata/geoip-city-test.mmdb"
+	testASNDB  = "testdata/geoip-asn-test.mmdb"
+)
+
+func TestGeoIPLookup(t *testing.T) {
+	g, err := NewGeoIP(testCityDB, testASNDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	tests := []struct {
+		addr string
+		want GeoLocation
+		str  string
+	}{
+		{"203.0.113.7", GeoLocation{IP: "203.0.113.7", Country: "Germany", CountryCode: "DE", City: "Berlin", ASN: 64500, Organization: "Example Telecom"}, "Berlin, Germany (Example Telecom)"},
+		{"::ffff:203.0.113.8", GeoLocation{IP: "203.0.113.8", Country: "Germany", CountryCode: "DE", City: "Berlin", ASN: 64500, Organization: "Example Telecom"}, "Berlin, Germany (Example Telecom)"},
+		{"198.51.100.1", GeoLocation{IP: "198.51.100.1", Country: "France", CountryCode: "FR"}, "France"},
+		{"2001:db8::1", GeoLocation{IP: "2001:db8::1", Country: "Japan", CountryCode: "JP", City: "Tokyo", ASN: 64501, Organization: "Example Net"}, "Tokyo, Japan (Example Net)"},
+		{"192.0.2.1", GeoLocation{IP: "192.0.2.1"}, "Unknown location"},
+	}
+	for _, tt := range tests {
+		loc, err := g.Lookup(netip.MustParseAddr(tt.addr))
+		if err != nil {
+			t.Errorf("Lookup(%s): %v", tt.addr, err)
+			continue
+		}
+		if loc != tt.want {
+			t.Errorf("Lookup(%s) = %+v, want %+v", tt.addr, loc, tt.want)
+		}
+		if s := loc.String(); s != tt.str {
+			t.Errorf("Lookup(%s).String() = %q, want %q", tt.addr, s, tt.str)
+		}
+	}
+}
+
+func TestGeoIPOpenErrors(t *testing.T) {
+	if _, err := NewGeoIP(); err == nil {
+		t.Error("NewGeoIP() without databases should fail")
+	}
+	if _, err := NewGeoIP(testCityDB, "testdata/missing.mmdb"); err == nil {
+		t.Error("NewGeoIP() with a missing database should fail")
+	}
+	if _, err := NewGeoIP("testdata/gen_geoip.go"); err == nil {
+		t.Error("NewGeoIP() with an invalid database should fail")
+	}
+}
+
+func TestGeoIPReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.mmdb")
+	copyFile(t, testASNDB, path)
+
+	g, err := NewGeoIP(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	addr := netip.MustParseAddr("203.0.113.7")
+	if loc, _ := g.Lookup(addr); loc.City != "" || loc.ASN != 64500 {
+		t.Fatalf("Lookup() before reload = %+v", loc)
+	}
+
+	copyFile(t, testCityDB, path)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// The cache is purged on reload
+	if loc, _ := g.Lookup(addr); loc.City != "Berlin" || loc.ASN != 0 {
+		t.Errorf("Lookup() after reload = %+v", loc)
+	}
+}
+
+func TestGeoIPReloadConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.mmdb")
+	copyFile(t, testCityDB, path)
+	for round := 0; round < 20; round++ {
+		g, err := NewGeoIP(path, testASNDB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					later := time.Now().Add(time.Duration(i*1000+j) * time.Second)
+					os.Chtimes(path, later, later)
+					// Reloads racing with Close fail with errGeoIPClosed but must not panic
+					g.Reload()
+				}
+			}(i)
+		}
+		time.Sleep(time.Millisecond)
+		if err := g.Close(); err != nil {
+			t.Errorf("Close during reloads = %v", err)
+		}
+		wg.Wait()
+	}
+}
+
+func TestGeoIPClosed(t *testing.T) {
+	g, err := NewGeoIP(testCityDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetCache(0, 0)
+	g.Close()
+	if _, err := g.Lookup(netip.MustParseAddr("203.0.113.7")); err == nil {
+		t.Error("Lookup() on a closed database should fail")
+	}
+}
+
+func TestInitGeoIPConcurrent(t *testing.T) {
+	if err := InitGeoIP(testCityDB); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if old := geoIPDB.Swap(nil); old != nil {
+			old.Close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = "203.0.113.7:1234"
+				// Lookups racing with InitGeoIP may hit the closed database
+				GetISPLocationFromReq(r)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := InitGeoIP(testCityDB, testASNDB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	if loc := GetISPLocationFromReq(r); loc != "Berlin, Germany (Example Telecom)" {
+		t.Errorf("GetISPLocationFromReq() = %q", loc)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
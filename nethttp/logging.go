@@ -0,0 +1,358 @@
+package nethttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hooks - Callbacks invoked around every outgoing request of a HookTransport, nil hooks are skipped
+type Hooks struct {
+	BeforeSend   func(req *http.Request)
+	AfterReceive func(req *http.Request, resp *http.Response, latency time.Duration)
+	OnError      func(req *http.Request, err error, latency time.Duration)
+}
+
+// HookTransport - RoundTripper invoking Hooks before sending and after receiving
+type HookTransport struct {
+	Transport http.RoundTripper // nil uses http.DefaultTransport
+	Hooks     Hooks
+}
+
+// NewHookTransport - Creates a HookTransport on top of next, nil uses http.DefaultTransport
+func NewHookTransport(hooks Hooks, next http.RoundTripper) *HookTransport {
+	return &HookTransport{Transport: next, Hooks: hooks}
+}
+
+// RoundTrip - RoundTrip
+func (t *HookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if t.Hooks.BeforeSend != nil {
+		t.Hooks.BeforeSend(req)
+	}
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		if t.Hooks.OnError != nil {
+			t.Hooks.OnError(req, err, time.Since(start))
+		}
+		return resp, err
+	}
+	if t.Hooks.AfterReceive != nil {
+		t.Hooks.AfterReceive(req, resp, time.Since(start))
+	}
+	return resp, nil
+}
+
+// Redactor - Masks secrets in headers, query parameters, JSON and form bodies before they are logged
+type Redactor struct {
+	Headers     []string // header names, case insensitive
+	Fields      []string // JSON field and query parameter names, case insensitive
+	Replacement string
+}
+
+// DefaultRedactor - Redacts credentials, cookies and common secret fields
+var DefaultRedactor = Redactor{
+	Headers:     []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"},
+	Fields:      []string{"password", "secret", "client_secret", "token", "access_token", "refresh_token", "id_token", "api_key", "apikey"},
+	Replacement: "[REDACTED]",
+}
+
+func (r *Redactor) replacement() string {
+	if r.Replacement != "" {
+		return r.Replacement
+	}
+	return "[REDACTED]"
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header - Returns a copy of h with sensitive values replaced
+func (r *Redactor) Header(h http.Header) http.Header {
+	out := h.Clone()
+	for k := range out {
+		if containsFold(r.Headers, k) {
+			out[k] = []string{r.replacement()}
+		}
+	}
+	return out
+}
+
+// URL - Returns u as a string with sensitive query parameters and user info replaced
+func (r *Redactor) URL(u *url.URL) string {
+	c := *u
+	if c.User != nil {
+		c.User = url.User(c.User.Username())
+	}
+	q := c.Query()
+	changed := false
+	for k := range q {
+		if containsFold(r.Fields, k) {
+			q[k] = []string{r.replacement()}
+			changed = true
+		}
+	}
+	if changed {
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
+
+// JSON - Returns body with sensitive fields replaced at any depth, non JSON bodies are returned unchanged
+func (r *Redactor) JSON(body []byte) []byte {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return body
+	}
+	out, err := json.Marshal(r.redactValue(v))
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// Body - Returns body with sensitive JSON or form fields replaced, any other body is replaced as a whole
+// because the secrets it may contain cannot be found
+func (r *Redactor) Body(body []byte, contentType string) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k := range form {
+				if containsFold(r.Fields, k) {
+					form[k] = []string{r.replacement()}
+				}
+			}
+			return []byte(form.Encode())
+		}
+		return []byte(unparseableBody)
+	}
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return []byte(unparseableBody)
+	}
+	out, err := json.Marshal(r.redactValue(v))
+	if err != nil {
+		return []byte(unparseableBody)
+	}
+	return out
+}
+
+const unparseableBody = "[unparseable body redacted]"
+
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, field := range val {
+			if containsFold(r.Fields, k) {
+				val[k] = r.replacement()
+				continue
+			}
+			val[k] = r.redactValue(field)
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = r.redactValue(val[i])
+		}
+	}
+	return v
+}
+
+// LoggingOptions - Configuration of NewLoggingTransport
+type LoggingOptions struct {
+	Logger     *slog.Logger // default slog.Default()
+	Level      slog.Level   // level of successful requests, errors and 5xx are logged at error level
+	Redactor   *Redactor    // default DefaultRedactor
+	LogHeaders bool         // log request and response headers
+	LogBodies  bool         // log request and response bodies, redacted with Redactor.Body and truncated to MaxBodyLog
+	// MaxBodyLog is the number of body bytes logged, default 4KB
+	MaxBodyLog int
+	// CurlDump adds a curl command reproducing the request to every record
+	CurlDump bool
+}
+
+// NewLoggingTransport - RoundTripper logging method, URL, status, latency and sizes of every request with slog.
+// The record is written when the response body is closed so that the response size is known.
+func NewLoggingTransport(opts LoggingOptions, next http.RoundTripper) http.RoundTripper {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Redactor == nil {
+		opts.Redactor = &DefaultRedactor
+	}
+	if opts.MaxBodyLog <= 0 {
+		opts.MaxBodyLog = 4 << 10
+	}
+	return &loggingTransport{opts: opts, next: next}
+}
+
+type loggingTransport struct {
+	opts LoggingOptions
+	next http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.next
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	var reqBody []byte
+	if t.opts.LogBodies || t.opts.CurlDump {
+		req = req.Clone(req.Context())
+		body, err := readRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = body
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", t.opts.Redactor.URL(req.URL)),
+		slog.Int64("requestSize", req.ContentLength),
+	}
+	if t.opts.LogHeaders {
+		attrs = append(attrs, slog.Any("requestHeaders", t.opts.Redactor.Header(req.Header)))
+	}
+	if t.opts.LogBodies && len(reqBody) > 0 {
+		attrs = append(attrs, slog.String("requestBody", t.truncate(t.opts.Redactor.Body(reqBody, req.Header.Get("Content-Type")))))
+	}
+	if t.opts.CurlDump {
+		attrs = append(attrs, slog.String("curl", CurlCommand(req, reqBody, t.opts.Redactor)))
+	}
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		attrs = append(attrs, slog.Duration("latency", time.Since(start)), slog.String("error", err.Error()))
+		t.opts.Logger.LogAttrs(req.Context(), slog.LevelError, "http client request failed", attrs...)
+		return resp, err
+	}
+
+	level := t.opts.Level
+	if resp.StatusCode >= 500 {
+		level = slog.LevelError
+	}
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	if t.opts.LogHeaders {
+		attrs = append(attrs, slog.Any("responseHeaders", t.opts.Redactor.Header(resp.Header)))
+	}
+	ctx := req.Context()
+	resp.Body = &loggedBody{
+		ReadCloser: resp.Body,
+		capture:    t.opts.LogBodies,
+		done: func(n int64, body []byte) {
+			attrs := append(attrs,
+				slog.Duration("latency", time.Since(start)),
+				slog.Int64("responseSize", n),
+			)
+			if t.opts.LogBodies && len(body) > 0 {
+				attrs = append(attrs, slog.String("responseBody", t.truncate(t.opts.Redactor.Body(body, resp.Header.Get("Content-Type")))))
+			}
+			t.opts.Logger.LogAttrs(ctx, level, "http client request", attrs...)
+		},
+	}
+	return resp, nil
+}
+
+func (t *loggingTransport) truncate(body []byte) string {
+	if len(body) > t.opts.MaxBodyLog {
+		return string(body[:t.opts.MaxBodyLog]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+// maxBodyCapture bounds the response body kept for redaction, larger bodies are logged as unparseable
+const maxBodyCapture = 1 << 20
+
+// loggedBody counts and optionally captures the response body, calling done once when closed.
+// The whole body is captured because a truncated one cannot be redacted.
+type loggedBody struct {
+	io.ReadCloser
+	capture  bool
+	overflow bool
+	n        int64
+	buf      bytes.Buffer
+	once     sync.Once
+	done     func(n int64, body []byte)
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.capture && !b.overflow {
+		if b.buf.Len()+n > maxBodyCapture {
+			b.overflow = true
+			b.buf.Reset()
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		body := b.buf.Bytes()
+		if b.overflow {
+			body = []byte(unparseableBody)
+		}
+		b.done(b.n, body)
+	})
+	return err
+}
+
+// CurlCommand - Returns a curl command reproducing the request with sensitive values redacted
+func CurlCommand(req *http.Request, body []byte, redactor *Redactor) string {
+	if redactor == nil {
+		redactor = &DefaultRedactor
+	}
+	var sb strings.Builder
+	sb.WriteString("curl -X ")
+	sb.WriteString(req.Method)
+	sb.WriteString(" ")
+	sb.WriteString(shellQuote(redactor.URL(req.URL)))
+
+	header := redactor.Header(req.Header)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			sb.WriteString(" -H ")
+			sb.WriteString(shellQuote(k + ": " + v))
+		}
+	}
+	if len(body) > 0 {
+		sb.WriteString(" --data-binary ")
+		sb.WriteString(shellQuote(string(redactor.Body(body, req.Header.Get("Content-Type")))))
+	}
+	return sb.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
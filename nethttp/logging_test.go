@@ -0,0 +1,87 @@
+package nethttp
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactorBody(t *testing.T) {
+	tests := []struct {
+		body        string
+		contentType string
+		want        string
+	}{
+		{`{"user":"bob","auth":{"Password":"hunter2"}}`, "application/json", `{"auth":{"Password":"[REDACTED]"},"user":"bob"}`},
+		{`[{"token":"abc"}]`, "", `[{"token":"[REDACTED]"}]`},
+		{`user=bob&password=hunter2`, "application/x-www-form-urlencoded; charset=utf-8", `password=%5BREDACTED%5D&user=bob`},
+		{`user=bob&password=%zz`, "application/x-www-form-urlencoded", unparseableBody},
+		{`{"token":"abc"`, "application/json", unparseableBody},
+		{`token=abc`, "text/plain", unparseableBody},
+		{``, "application/json", ``},
+	}
+	for _, tt := range tests {
+		if got := string(DefaultRedactor.Body([]byte(tt.body), tt.contentType)); got != tt.want {
+			t.Errorf("Body(%q, %q) = %q, want %q", tt.body, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestLoggingTransportRedactsBeforeTruncating(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"s3cr3t","padding":"`+strings.Repeat("x", 100)+`"}`)
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	client := &http.Client{Transport: NewLoggingTransport(LoggingOptions{
+		Logger:     slog.New(slog.NewTextHandler(&logs, nil)),
+		LogBodies:  true,
+		MaxBodyLog: 20,
+	}, nil)}
+	resp, err := client.Post(srv.URL, "application/x-www-form-urlencoded", strings.NewReader("client_secret=hunter2&grant_type=client_credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	out := logs.String()
+	if strings.Contains(out, "s3cr3t") || strings.Contains(out, "hunter2") {
+		t.Errorf("secret logged: %s", out)
+	}
+	if !strings.Contains(out, "...(truncated)") {
+		t.Errorf("body not truncated: %s", out)
+	}
+}
+
+func TestLoggingTransportLargeBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"token":"s3cr3t","padding":"`+strings.Repeat("x", maxBodyCapture)+`"}`)
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	client := &http.Client{Transport: NewLoggingTransport(LoggingOptions{
+		Logger:    slog.New(slog.NewTextHandler(&logs, nil)),
+		LogBodies: true,
+	}, nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if n <= maxBodyCapture {
+		t.Fatalf("read %d bytes", n)
+	}
+	if out := logs.String(); strings.Contains(out, "s3cr3t") || !strings.Contains(out, unparseableBody) {
+		t.Errorf("large body logged as %s", out)
+	}
+}
@@ -0,0 +1,370 @@
+package nethttp
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func compressedGet(t *testing.T, url, acceptEncoding string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	// A custom Accept-Encoding disables the transparent decompression of the client
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestCompressFlushBeforeWrite(t *testing.T) {
+	srv := httptest.NewServer(Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "hello")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, " world")
+	})))
+	defer srv.Close()
+
+	resp, body := compressedGet(t, srv.URL, "gzip")
+	if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+	zr, err := gzip.NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "hello world" {
+		t.Errorf("body = %q", plain)
+	}
+}
+
+func TestCompressSkipsEncodedAndEmptyResponses(t *testing.T) {
+	srv := httptest.NewServer(Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Encoding", "identity")
+		io.WriteString(w, "plain")
+	})))
+	defer srv.Close()
+
+	resp, body := compressedGet(t, srv.URL, "br, gzip")
+	if resp.Header.Get("Content-Encoding") != "identity" || body != "plain" {
+		t.Errorf("handler encoding was overridden: %q %q", resp.Header.Get("Content-Encoding"), body)
+	}
+	resp, _ = compressedGet(t, srv.URL+"/empty", "gzip")
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Errorf("204 Content-Encoding = %q", ce)
+	}
+}
+
+func TestCompressHijack(t *testing.T) {
+	srv := httptest.NewServer(Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})))
+	defer srv.Close()
+
+	resp, body := compressedGet(t, srv.URL, "gzip")
+	if resp.StatusCode != 200 || body != "hijacked" {
+		t.Errorf("response = %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"gzip":                 "gzip",
+		"gzip, deflate, br":    "br",
+		"br;q=0, gzip;q=0.5":   "gzip",
+		"identity":             "",
+		"GZIP;q=1":             "gzip",
+		"br;q=0.0, gzip;q=0.0": "",
+	}
+	for accept, want := range tests {
+		if got := negotiateEncoding(accept); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(mark("a"), mark("b"), mark("c"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(order, ","); got != "a,b,c,handler" {
+		t.Errorf("order = %s", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+		if r.Header.Get(RequestIDHeader) != seen {
+			t.Errorf("request header = %q, context = %q", r.Header.Get(RequestIDHeader), seen)
+		}
+	}))
+	tests := []struct {
+		incoming string
+		keep     bool
+	}{
+		{"abc-123", true},
+		{"", false},
+		{"with space", false},
+		{"line\nbreak", false},
+		{strings.Repeat("x", 129), false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.incoming != "" {
+			r.Header.Set(RequestIDHeader, tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		echoed := w.Header().Get(RequestIDHeader)
+		if echoed != seen || seen == "" {
+			t.Errorf("%q: response ID %q, context ID %q", tt.incoming, echoed, seen)
+		}
+		if (seen == tt.incoming) != tt.keep {
+			t.Errorf("%q: propagated as %q", tt.incoming, seen)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	h := Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/written" {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if !strings.Contains(logs.String(), "panic=boom") || !strings.Contains(logs.String(), "stack=") {
+		t.Errorf("log = %s", logs.String())
+	}
+
+	// A response already started is left alone
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/written", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("status after WriteHeader = %d, want 202", w.Code)
+	}
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler to be repanicked", rec)
+		}
+	}()
+	Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	tests := []struct {
+		name   string
+		opts   CORSOptions
+		method string
+		header map[string]string
+		status int
+		want   map[string]string
+	}{
+		{"preflight", CORSOptions{AllowedOrigins: []string{"https://app.example"}, AllowedHeaders: []string{"Authorization"}, MaxAge: time.Hour},
+			"OPTIONS", map[string]string{"Origin": "https://APP.example", "Access-Control-Request-Method": "PUT"},
+			http.StatusNoContent, map[string]string{
+				"Access-Control-Allow-Origin":  "https://APP.example",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "Authorization",
+				"Access-Control-Max-Age":       "3600",
+			}},
+		{"preflight echoes requested headers", CORSOptions{AllowedOrigins: []string{"*"}},
+			"OPTIONS", map[string]string{"Origin": "https://any.example", "Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "X-Custom"},
+			http.StatusNoContent, map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Headers": "X-Custom"}},
+		{"credentials never use the wildcard", CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true, ExposedHeaders: []string{"X-Total"}},
+			"GET", map[string]string{"Origin": "https://any.example"},
+			http.StatusOK, map[string]string{
+				"Access-Control-Allow-Origin":      "https://any.example",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total",
+			}},
+		{"disallowed origin", CORSOptions{AllowedOrigins: []string{"https://app.example"}},
+			"OPTIONS", map[string]string{"Origin": "https://evil.example", "Access-Control-Request-Method": "PUT"},
+			http.StatusOK, map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""}},
+		{"plain options", CORSOptions{AllowedOrigins: []string{"https://app.example"}},
+			"OPTIONS", map[string]string{"Origin": "https://app.example"},
+			http.StatusOK, map[string]string{"Access-Control-Allow-Origin": "https://app.example", "Access-Control-Allow-Methods": ""}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		CORS(tt.opts)(ok).ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		for k, v := range tt.want {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", tt.name, k, got, v)
+			}
+		}
+		if !strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Origin") {
+			t.Errorf("%s: Vary = %v", tt.name, w.Header().Values("Vary"))
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h := MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name   string
+		body   string
+		length int64
+		status int
+	}{
+		{"small", "12345678", 8, http.StatusOK},
+		{"declared too large", "123456789", 9, http.StatusRequestEntityTooLarge},
+		{"chunked too large", "123456789", -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		r.ContentLength = tt.length
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	w := httptest.NewRecorder()
+	SecurityHeaders(SecurityHeadersOptions{})(ok).ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil))
+	want := map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"Content-Security-Policy":   "",
+		"Strict-Transport-Security": "",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	opts := SecurityHeadersOptions{ContentSecurityPolicy: "default-src 'self'", FrameOptions: "SAMEORIGIN", HSTSMaxAge: time.Hour, HSTSIncludeSubdomains: true}
+	SecurityHeaders(opts)(ok).ServeHTTP(w, httptest.NewRequest("GET", "https://example.com/", nil))
+	want = map[string]string{
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Content-Security-Policy":   "default-src 'self'",
+		"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("TLS %s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			<-r.Context().Done()
+		case "/late":
+			<-r.Context().Done()
+			io.WriteString(w, "partial")
+		default:
+			io.WriteString(w, "fast")
+		}
+	}))
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/", http.StatusOK, "fast"},
+		{"/slow", http.StatusServiceUnavailable, "Service Unavailable\n"},
+		{"/late", http.StatusOK, "partial"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestTimeoutStreams(t *testing.T) {
+	srv := httptest.NewServer(Chain(Timeout(time.Second), Compress())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sse, err := NewSSEWriter(w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sse.Send(Event{Data: "first"})
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("request context has no deadline")
+		}
+	})))
+	defer srv.Close()
+
+	resp, body := compressedGet(t, srv.URL, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "data: first") {
+		t.Errorf("response = %d %q", resp.StatusCode, body)
+	}
+}
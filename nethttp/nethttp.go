@@ -12,12 +12,46 @@ import (
 	"time"
 )
 
-// GetBytes - GetBytes
-func GetBytes(url string, headers, params map[string]string) ([]byte, int, error) {
+// Client - HTTP client used by the request helpers, e.g. NewClient(NewCachingTransport(store, nil))
+type Client struct {
+	HTTPClient *http.Client
+}
 
-	client := &http.Client{
-		Timeout: time.Duration(5 * time.Second),
+// DefaultClient - Client used by the package level request helpers
+var DefaultClient = NewClient(nil)
+
+// NewClient - Creates a client with a 5 second timeout using transport, nil uses http.DefaultTransport
+func NewClient(transport http.RoundTripper) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout:   time.Duration(5 * time.Second),
+			Transport: transport,
+		},
 	}
+}
+
+// GetBytes - GetBytes using DefaultClient
+func GetBytes(url string, headers, params map[string]string) ([]byte, int, error) {
+	return DefaultClient.GetBytes(url, headers, params)
+}
+
+// Get - Get using DefaultClient
+func Get(url string, header, params map[string]string) (interface{}, int, error) {
+	return DefaultClient.Get(url, header, params)
+}
+
+// PostJSON - PostJSON using DefaultClient
+func PostJSON(url string, header, params map[string]string, request interface{}, response interface{}) (int, error) {
+	return DefaultClient.PostJSON(url, header, params, request, response)
+}
+
+// PostFormDataWithHeaders - Creates a new file upload http request with optional extra params along with headers using DefaultClient
+func PostFormDataWithHeaders(uri string, params map[string]string, headers map[string]string, paramName string, fileContents []byte, fileName string, res interface{}) (int, error) {
+	return DefaultClient.PostFormDataWithHeaders(uri, params, headers, paramName, fileContents, fileName, res)
+}
+
+// GetBytes - GetBytes
+func (c *Client) GetBytes(url string, headers, params map[string]string) ([]byte, int, error) {
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -34,7 +68,7 @@ func GetBytes(url string, headers, params map[string]string) ([]byte, int, error
 	}
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := client.Do(req)
+	resp, err := c.HTTPClient.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
 	} else if err != nil {
@@ -54,10 +88,10 @@ func GetBytes(url string, headers, params map[string]string) ([]byte, int, error
 }
 
 // Get - Get
-func Get(url string, header, params map[string]string) (interface{}, int, error) {
+func (c *Client) Get(url string, header, params map[string]string) (interface{}, int, error) {
 	var response interface{}
 
-	body, code, err := GetBytes(url, header, params)
+	body, code, err := c.GetBytes(url, header, params)
 	if err != nil {
 		return nil, code, err
 	}
@@ -70,17 +104,13 @@ func Get(url string, header, params map[string]string) (interface{}, int, error)
 }
 
 // PostJSON - PostJSON
-func PostJSON(url string, header, params map[string]string, request interface{}, response interface{}) (int, error) {
+func (c *Client) PostJSON(url string, header, params map[string]string, request interface{}, response interface{}) (int, error) {
 
 	body, err := json.Marshal(request)
 	if err != nil {
 		return -1, err
 	}
 
-	client := &http.Client{
-		Timeout: time.Duration(5 * time.Second),
-	}
-
 	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
 		return -1, err
@@ -97,7 +127,7 @@ func PostJSON(url string, header, params map[string]string, request interface{},
 	}
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := client.Do(req)
+	resp, err := c.HTTPClient.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
 	} else if err != nil {
@@ -121,27 +151,18 @@ func PostJSON(url string, header, params map[string]string, request interface{},
 }
 
 // GetIPFromReq return client's real public IP address from http request headers.
+// Only the forwarding header of DefaultIPResolver, X-Forwarded-For unless changed with
+// SetTrustedProxies, is honoured and only when set by a trusted proxy.
 func GetIPFromReq(r *http.Request) string {
-	xTrueClientIP := r.Header.Get("True-Client-IP")
-	if xTrueClientIP != "" {
-		return xTrueClientIP
-	}
-
-	xForwardedFor := r.Header.Get("X-Forwarded-For")
-	if xForwardedFor != "" {
-		return xForwardedFor
-	}
-
-	xRealIP := r.Header.Get("X-Real-Ip")
-	if xRealIP != "" {
-		return xRealIP
-	}
-
-	if strings.ContainsRune(r.RemoteAddr, ':') {
-		remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
-		return remoteIP
+	addr, err := DefaultIPResolver().Resolve(r)
+	if err != nil {
+		if strings.ContainsRune(r.RemoteAddr, ':') {
+			remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+			return remoteIP
+		}
+		return r.RemoteAddr
 	}
-	return r.RemoteAddr
+	return addr.String()
 }
 
 // GetUserAgentFromReq return client's user agent string from http request headers.
@@ -154,13 +175,30 @@ func GetUserAgentFromReq(r *http.Request) string {
 }
 
 // GetISPLocationFromReq return client's ISP location from http request headers.
-// TODO: Complete this function
+// Requires the GeoIP databases to be loaded with InitGeoIP.
 func GetISPLocationFromReq(r *http.Request) string {
-	return "Unknown location"
+	loc, err := GetGeoLocationFromReq(r)
+	if err != nil {
+		return "Unknown location"
+	}
+	return loc.String()
+}
+
+// GetGeoLocationFromReq return client's country, city, ASN and ISP from the GeoIP databases.
+func GetGeoLocationFromReq(r *http.Request) (GeoLocation, error) {
+	db := GeoIPDB()
+	if db == nil {
+		return GeoLocation{}, fmt.Errorf("geoip database is not initialized")
+	}
+	addr, err := DefaultIPResolver().Resolve(r)
+	if err != nil {
+		return GeoLocation{}, err
+	}
+	return db.Lookup(addr)
 }
 
 // PostFormDataWithHeaders - Creates a new file upload http request with optional extra params along with headers
-func PostFormDataWithHeaders(uri string, params map[string]string, headers map[string]string, paramName string, fileContents []byte, fileName string, res interface{}) (int, error) {
+func (c *Client) PostFormDataWithHeaders(uri string, params map[string]string, headers map[string]string, paramName string, fileContents []byte, fileName string, res interface{}) (int, error) {
 	body := new(bytes.Buffer)
 	writer := multipart.NewWriter(body)
 	part, err := writer.CreateFormFile(paramName, fileName)
@@ -186,16 +224,12 @@ func PostFormDataWithHeaders(uri string, params map[string]string, headers map[s
 		request.Header.Add(k, v)
 	}
 
-	client := &http.Client{
-		Timeout: time.Duration(5 * time.Second),
-	}
-
-	resp, err := client.Do(request)
+	resp, err := c.HTTPClient.Do(request)
 
 	if resp != nil {
 		defer resp.Body.Close()
 	} else if err != nil {
-		return resp.StatusCode, err
+		return -1, err
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
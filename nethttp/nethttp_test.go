@@ -0,0 +1,42 @@
+package nethttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostFormDataWithHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("upload")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"` + header.Filename + `","token":"` + r.Header.Get("X-Token") + `","kind":"` + r.FormValue("kind") + `"}`))
+	}))
+	defer srv.Close()
+
+	var res map[string]string
+	code, err := PostFormDataWithHeaders(srv.URL, map[string]string{"kind": "avatar"}, map[string]string{"X-Token": "t"}, "upload", []byte("data"), "a.png", &res)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("PostFormDataWithHeaders = %d, %v", code, err)
+	}
+	if res["name"] != "a.png" || res["token"] != "t" || res["kind"] != "avatar" {
+		t.Errorf("response = %v", res)
+	}
+}
+
+func TestPostFormDataWithHeadersTransportError(t *testing.T) {
+	failed := errors.New("connection refused")
+	c := NewClient(roundTripFunc(func(*http.Request) (*http.Response, error) { return nil, failed }))
+
+	// Used to dereference the nil response
+	code, err := c.PostFormDataWithHeaders("http://example.invalid", nil, nil, "upload", []byte("data"), "a.png", nil)
+	if code != -1 || !errors.Is(err, failed) {
+		t.Errorf("PostFormDataWithHeaders = %d, %v, want -1 and the transport error", code, err)
+	}
+}
@@ -0,0 +1,505 @@
+// Package nethttptest records real HTTP exchanges to cassette files and replays them in tests.
+//
+//	rec := nethttptest.NewForTest(t, "testdata/orders.yaml")
+//	nethttp.DefaultClient = rec.Client()
+//
+// Cassettes are recorded when NETHTTP_RECORD is set and replayed otherwise.
+package nethttptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	nethttp "github.com/ac333d/go-libs/nethttp"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Mode - Recorder behaviour
+type Mode int
+
+const (
+	// ModeReplay serves every request from the cassette and fails on unknown requests
+	ModeReplay Mode = iota
+	// ModeRecord sends every request and overwrites the cassette on Stop
+	ModeRecord
+	// ModeReplayOrRecord replays known requests and records new ones
+	ModeReplayOrRecord
+	// ModePassthrough sends every request without touching the cassette
+	ModePassthrough
+)
+
+// RecordEnv - Environment variable switching NewForTest to ModeRecord
+const RecordEnv = "NETHTTP_RECORD"
+
+// ModeFromEnv - ModeRecord when NETHTTP_RECORD is set, ModeReplay otherwise
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) != "" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Request - Recorded request
+type Request struct {
+	Method       string      `json:"method" yaml:"method"`
+	URL          string      `json:"url" yaml:"url"`
+	Header       http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body         string      `json:"body,omitempty" yaml:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"`
+}
+
+// Response - Recorded response
+type Response struct {
+	Status       int         `json:"status" yaml:"status"`
+	Header       http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body         string      `json:"body,omitempty" yaml:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"`
+}
+
+// Interaction - One recorded request and its response
+type Interaction struct {
+	Request  Request  `json:"request" yaml:"request"`
+	Response Response `json:"response" yaml:"response"`
+}
+
+// Cassette - File format of a recording, YAML or JSON depending on the file extension
+type Cassette struct {
+	Version      int            `json:"version" yaml:"version"`
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// Matcher - Reports whether an incoming request matches a recorded one, both already scrubbed
+type Matcher func(got, recorded Request) bool
+
+// MatchMethod - Matches the request method
+func MatchMethod(got, recorded Request) bool {
+	return got.Method == recorded.Method
+}
+
+// MatchURL - Matches the URL, ignoring the order of query parameters
+func MatchURL(got, recorded Request) bool {
+	g, err1 := url.Parse(got.URL)
+	r, err2 := url.Parse(recorded.URL)
+	if err1 != nil || err2 != nil {
+		return got.URL == recorded.URL
+	}
+	if g.Scheme != r.Scheme || g.Host != r.Host || g.Path != r.Path {
+		return false
+	}
+	return g.Query().Encode() == r.Query().Encode()
+}
+
+// MatchBody - Matches the body byte for byte
+func MatchBody(got, recorded Request) bool {
+	return got.Body == recorded.Body
+}
+
+// MatchJSONBody - Matches JSON bodies semantically, other bodies byte for byte
+func MatchJSONBody(got, recorded Request) bool {
+	g, err1 := decodeJSON(got.Body)
+	r, err2 := decodeJSON(recorded.Body)
+	if err1 != nil || err2 != nil {
+		return got.Body == recorded.Body
+	}
+	gb, _ := json.Marshal(g)
+	rb, _ := json.Marshal(r)
+	return bytes.Equal(gb, rb)
+}
+
+// DefaultMatchers - Method, URL and JSON aware body matching
+var DefaultMatchers = []Matcher{MatchMethod, MatchURL, MatchJSONBody}
+
+// Scrubber - Removes secrets from an interaction before it is saved or matched
+type Scrubber func(*Interaction)
+
+const scrubbed = "[SCRUBBED]"
+
+// ScrubHeaders - Replaces request and response header values
+func ScrubHeaders(names ...string) Scrubber {
+	return func(i *Interaction) {
+		for _, name := range names {
+			for _, h := range []http.Header{i.Request.Header, i.Response.Header} {
+				if h != nil && h.Get(name) != "" {
+					h.Set(name, scrubbed)
+				}
+			}
+		}
+	}
+}
+
+// ScrubQueryParams - Replaces query parameter values of the request URL
+func ScrubQueryParams(names ...string) Scrubber {
+	return func(i *Interaction) {
+		u, err := url.Parse(i.Request.URL)
+		if err != nil {
+			return
+		}
+		q := u.Query()
+		changed := false
+		for _, name := range names {
+			if q.Has(name) {
+				q.Set(name, scrubbed)
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = q.Encode()
+			i.Request.URL = u.String()
+		}
+	}
+}
+
+// ScrubJSONFields - Replaces JSON fields at any depth of request and response bodies.
+// Bodies without any of the fields are kept byte for byte, numbers keep their precision.
+func ScrubJSONFields(fields ...string) Scrubber {
+	return func(i *Interaction) {
+		if i.Request.BodyEncoding == "" {
+			i.Request.Body = scrubJSON(i.Request.Body, fields)
+		}
+		if i.Response.BodyEncoding == "" {
+			i.Response.Body = scrubJSON(i.Response.Body, fields)
+		}
+	}
+}
+
+func scrubJSON(body string, fields []string) string {
+	v, err := decodeJSON(body)
+	if err != nil || !scrubValue(v, fields) {
+		return body
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// decodeJSON decodes a single JSON value keeping numbers as json.Number so they are encoded back unchanged
+func decodeJSON(body string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// scrubValue replaces the fields in v in place and reports whether any was found
+func scrubValue(v interface{}, fields []string) bool {
+	changed := false
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, field := range val {
+			if containsFold(fields, k) {
+				val[k] = scrubbed
+				changed = true
+				continue
+			}
+			changed = scrubValue(field, fields) || changed
+		}
+	case []interface{}:
+		for _, item := range val {
+			changed = scrubValue(item, fields) || changed
+		}
+	}
+	return changed
+}
+
+// DefaultScrubbers - Scrubs the credentials redacted by nethttp.DefaultRedactor
+var DefaultScrubbers = []Scrubber{
+	ScrubHeaders(nethttp.DefaultRedactor.Headers...),
+	ScrubQueryParams(nethttp.DefaultRedactor.Fields...),
+	ScrubJSONFields(nethttp.DefaultRedactor.Fields...),
+}
+
+// Recorder - RoundTripper recording exchanges to, or replaying them from, a cassette file
+type Recorder struct {
+	Transport http.RoundTripper // used when recording, nil uses http.DefaultTransport
+	Matchers  []Matcher
+	Scrubbers []Scrubber
+
+	mu       sync.Mutex
+	path     string
+	mode     Mode
+	cassette *Cassette
+	used     []bool
+	dirty    bool
+}
+
+// New - Creates a recorder for the cassette at path, loading it unless mode is ModeRecord
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		Matchers:  DefaultMatchers,
+		Scrubbers: DefaultScrubbers,
+		path:      path,
+		mode:      mode,
+		cassette:  &Cassette{Version: 1},
+	}
+	if mode == ModeRecord || mode == ModePassthrough {
+		return r, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && mode == ModeReplayOrRecord {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette %s: %v", path, err)
+	}
+	if isJSON(path) {
+		err = json.Unmarshal(data, r.cassette)
+	} else {
+		err = yaml.Unmarshal(data, r.cassette)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding cassette %s: %v", path, err)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// NewForTest - Creates a recorder in ModeFromEnv mode that is saved when the test ends
+func NewForTest(t testing.TB, path string) *Recorder {
+	t.Helper()
+	r, err := New(path, ModeFromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := r.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return r
+}
+
+// Client - Returns a nethttp client using the recorder as transport
+func (r *Recorder) Client() *nethttp.Client {
+	return nethttp.NewClient(r)
+}
+
+// RoundTrip - Replays a matching interaction or records a real one depending on the mode
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	got := &Interaction{Request: newRequest(req, body)}
+	r.scrub(got)
+
+	if r.mode != ModeRecord && r.mode != ModePassthrough {
+		if resp, ok := r.replay(req, got.Request); ok {
+			return resp, nil
+		}
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("nethttptest: no recorded interaction for %s %s in %s", got.Request.Method, got.Request.URL, r.path)
+		}
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil || r.mode == ModePassthrough {
+		return resp, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	recorded := &Interaction{Request: newRequest(req, body), Response: newResponse(resp, respBody)}
+	r.scrub(recorded)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, recorded)
+	r.used = append(r.used, true)
+	r.dirty = true
+	return resp, nil
+}
+
+// replay returns the response of the first unused interaction matching the request
+func (r *Recorder) replay(req *http.Request, got Request) (*http.Response, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, it := range r.cassette.Interactions {
+		if r.used[i] || !r.matches(got, it.Request) {
+			continue
+		}
+		r.used[i] = true
+		return it.Response.toHTTP(req), true
+	}
+	return nil, false
+}
+
+func (r *Recorder) matches(got, recorded Request) bool {
+	for _, m := range r.Matchers {
+		if !m(got, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Recorder) scrub(i *Interaction) {
+	for _, s := range r.Scrubbers {
+		s(i)
+	}
+}
+
+// Stop - Writes recorded interactions to the cassette file
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return nil
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if isJSON(r.path) {
+		data, err = json.MarshalIndent(r.cassette, "", "  ")
+	} else {
+		data, err = yaml.Marshal(r.cassette)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding cassette %s: %v", r.path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing cassette %s: %v", r.path, err)
+	}
+	r.dirty = false
+	return nil
+}
+
+// Unused - Returns the recorded interactions that were not replayed
+func (r *Recorder) Unused() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []*Interaction
+	for i, it := range r.cassette.Interactions {
+		if !r.used[i] {
+			unused = append(unused, it)
+		}
+	}
+	return unused
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(body, encoding string) []byte {
+	if encoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(body)
+		if err == nil {
+			return data
+		}
+	}
+	return []byte(body)
+}
+
+func newRequest(req *http.Request, body []byte) Request {
+	b, enc := encodeBody(body)
+	return Request{
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		Header:       req.Header.Clone(),
+		Body:         b,
+		BodyEncoding: enc,
+	}
+}
+
+func newResponse(resp *http.Response, body []byte) Response {
+	b, enc := encodeBody(body)
+	return Response{
+		Status:       resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         b,
+		BodyEncoding: enc,
+	}
+}
+
+func (r Response) toHTTP(req *http.Request) *http.Response {
+	body := decodeBody(r.Body, r.BodyEncoding)
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	// Scrubbing may have changed the body length
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
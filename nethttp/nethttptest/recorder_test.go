@@ -0,0 +1,199 @@
+package nethttptest
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const apiResponse = `{"id": 9007199254740993, "html":"<b>&</b>", "items": [1.50, 2]}`
+
+func TestRecordThenReplay(t *testing.T) {
+	for _, name := range []string{"cassette.yaml", "cassette.json"} {
+		var hits int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=abc")
+			io.WriteString(w, apiResponse)
+		}))
+		path := filepath.Join(t.TempDir(), "testdata", name)
+
+		rec, err := New(path, ModeRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded := do(t, rec, srv.URL+"/orders?b=2&a=1&api_key=k", `{"token":"s3cret","n":1}`)
+		if recorded != apiResponse {
+			t.Errorf("%s: recorded response = %s", name, recorded)
+		}
+		if err := rec.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		srv.Close()
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"s3cret", "Bearer t", "session=abc", "api_key=k"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s: cassette contains %q", name, secret)
+			}
+		}
+
+		rec, err = New(path, ModeReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Query parameter order and JSON formatting do not matter, the scrubbed secrets neither
+		replayed := do(t, rec, srv.URL+"/orders?a=1&b=2&api_key=other", `{"n": 1, "token": "other"}`)
+		if replayed != apiResponse {
+			t.Errorf("%s: replayed response = %s\nwant %s", name, replayed, apiResponse)
+		}
+		if hits != 1 {
+			t.Errorf("%s: %d requests reached the server, want 1", name, hits)
+		}
+		if unused := rec.Unused(); len(unused) != 0 {
+			t.Errorf("%s: %d unused interactions", name, len(unused))
+		}
+		// Every interaction is replayed once
+		req, _ := http.NewRequest("POST", srv.URL+"/orders?a=1&b=2", strings.NewReader(`{"n":1}`))
+		if _, err := rec.RoundTrip(req); err == nil || !strings.Contains(err.Error(), "no recorded interaction") {
+			t.Errorf("%s: second replay = %v, want an error", name, err)
+		}
+	}
+}
+
+func do(t *testing.T, rec *Recorder, url, body string) string {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer t")
+	resp, err := (&http.Client{Transport: rec}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentLength != int64(len(data)) {
+		t.Errorf("Content-Length = %d, body has %d bytes", resp.ContentLength, len(data))
+	}
+	return string(data)
+}
+
+func TestReplayOrRecord(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+
+	if _, err := New(path, ModeReplay); err == nil {
+		t.Error("ModeReplay without a cassette succeeded")
+	}
+	rec, err := New(path, ModeReplayOrRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	do(t, rec, srv.URL+"/a", "")
+	rec.Stop()
+
+	rec, err = New(path, ModeReplayOrRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := do(t, rec, srv.URL+"/a", ""); got != "/a" {
+		t.Errorf("replayed /a = %s", got)
+	}
+	if got := do(t, rec, srv.URL+"/b", ""); got != "/b" {
+		t.Errorf("recorded /b = %s", got)
+	}
+	if hits != 2 {
+		t.Errorf("%d requests reached the server, want 2", hits)
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		name     string
+		matcher  Matcher
+		got, rec Request
+		want     bool
+	}{
+		{"method", MatchMethod, Request{Method: "GET"}, Request{Method: "GET"}, true},
+		{"other method", MatchMethod, Request{Method: "GET"}, Request{Method: "POST"}, false},
+		{"query order", MatchURL, Request{URL: "http://h/p?a=1&b=2"}, Request{URL: "http://h/p?b=2&a=1"}, true},
+		{"query value", MatchURL, Request{URL: "http://h/p?a=1"}, Request{URL: "http://h/p?a=2"}, false},
+		{"path", MatchURL, Request{URL: "http://h/p"}, Request{URL: "http://h/q"}, false},
+		{"host", MatchURL, Request{URL: "http://h/p"}, Request{URL: "http://g/p"}, false},
+		{"body", MatchBody, Request{Body: "a"}, Request{Body: "a"}, true},
+		{"body formatting", MatchBody, Request{Body: `{"a":1}`}, Request{Body: `{"a": 1}`}, false},
+		{"json formatting", MatchJSONBody, Request{Body: `{"a":1,"b":[true]}`}, Request{Body: "{\"b\": [true],\n\"a\": 1}"}, true},
+		{"json value", MatchJSONBody, Request{Body: `{"a":1}`}, Request{Body: `{"a":2}`}, false},
+		{"json large numbers", MatchJSONBody, Request{Body: `{"id":9007199254740993}`}, Request{Body: `{"id":9007199254740992}`}, false},
+		{"json trailing data", MatchJSONBody, Request{Body: `{"a":1} x`}, Request{Body: `{"a":1}`}, false},
+		{"not json", MatchJSONBody, Request{Body: "a=1"}, Request{Body: "a=1"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.matcher(tt.got, tt.rec); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScrubJSONFields(t *testing.T) {
+	scrub := ScrubJSONFields("token", "Password")
+	tests := []struct {
+		name, body, encoding, want string
+	}{
+		{"no field", apiResponse, "", apiResponse},
+		{"top level", `{"token":"x","id":9007199254740993,"html":"<b>&</b>"}`, "",
+			`{"html":"<b>&</b>","id":9007199254740993,"token":"[SCRUBBED]"}`},
+		{"nested", `{"users":[{"password":"x"}]}`, "", `{"users":[{"password":"[SCRUBBED]"}]}`},
+		{"not json", "token=x", "", "token=x"},
+		{"trailing data", `{"token":"x"} {}`, "", `{"token":"x"} {}`},
+		{"base64", "eyJ0b2tlbiI6IngifQ==", "base64", "eyJ0b2tlbiI6IngifQ=="},
+	}
+	for _, tt := range tests {
+		i := &Interaction{
+			Request:  Request{Body: tt.body, BodyEncoding: tt.encoding},
+			Response: Response{Body: tt.body, BodyEncoding: tt.encoding},
+		}
+		scrub(i)
+		if i.Request.Body != tt.want || i.Response.Body != tt.want {
+			t.Errorf("%s: bodies = %s, %s, want %s", tt.name, i.Request.Body, i.Response.Body, tt.want)
+		}
+	}
+}
+
+func TestScrubHeadersAndQueryParams(t *testing.T) {
+	i := &Interaction{
+		Request:  Request{URL: "http://h/p?b=2&a=1", Header: http.Header{"Authorization": {"Bearer t"}}},
+		Response: Response{Header: http.Header{"Set-Cookie": {"s=1"}}},
+	}
+	ScrubHeaders("authorization", "Set-Cookie", "X-Missing")(i)
+	if i.Request.Header.Get("Authorization") != scrubbed || i.Response.Header.Get("Set-Cookie") != scrubbed {
+		t.Errorf("headers = %v, %v", i.Request.Header, i.Response.Header)
+	}
+	if _, ok := i.Request.Header["X-Missing"]; ok {
+		t.Error("missing header added")
+	}
+
+	ScrubQueryParams("token")(i)
+	if i.Request.URL != "http://h/p?b=2&a=1" {
+		t.Errorf("URL without the parameter = %s", i.Request.URL)
+	}
+	ScrubQueryParams("a")(i)
+	if i.Request.URL != "http://h/p?a=%5BSCRUBBED%5D&b=2" {
+		t.Errorf("scrubbed URL = %s", i.Request.URL)
+	}
+}
@@ -0,0 +1,388 @@
+package nethttp
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// CheckFunc - Dependency check used by the readiness endpoint, e.g.
+// func(ctx context.Context) error { return redis.Ping(pool) }
+type CheckFunc func(ctx context.Context) error
+
+// PingCheck - Adapts a context unaware ping such as redis.Ping to a CheckFunc
+func PingCheck(ping func() error) CheckFunc {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() { done <- ping() }()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ServerConfig - Configuration of a Server, zero values use the defaults below
+type ServerConfig struct {
+	Addr              string        // default ":8080"
+	ReadTimeout       time.Duration // default 15s
+	ReadHeaderTimeout time.Duration // default 5s
+	WriteTimeout      time.Duration // default 30s
+	IdleTimeout       time.Duration // default 120s
+	ShutdownTimeout   time.Duration // time given to in-flight requests to drain, default 30s
+	ShutdownDelay     time.Duration // time between failing readiness and closing listeners
+	CheckTimeout      time.Duration // timeout of each readiness check, default 2s
+	HealthPath        string        // default "/healthz"
+	ReadyPath         string        // default "/readyz"
+
+	CertFile           string // enables TLS together with KeyFile
+	KeyFile            string
+	CertReloadInterval time.Duration // default 1m
+	TLSConfig          *tls.Config
+
+	// UnencryptedHTTP2 serves HTTP/2 without TLS (h2c), HTTP/2 is always enabled with TLS
+	UnencryptedHTTP2 bool
+
+	Logger *slog.Logger
+}
+
+// Server - HTTP server with health endpoints, graceful shutdown and certificate reloading
+type Server struct {
+	cfg    ServerConfig
+	srv    *http.Server
+	logger *slog.Logger
+
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+
+	ready    atomic.Int32 // readyUnset until Serve or SetReady
+	draining atomic.Bool
+	cert     *certReloader
+}
+
+// NewServer - Creates a server for handler
+func NewServer(cfg ServerConfig, handler http.Handler) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = 15 * time.Second
+	}
+	if cfg.ReadHeaderTimeout == 0 {
+		cfg.ReadHeaderTimeout = 5 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 30 * time.Second
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 120 * time.Second
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.CheckTimeout == 0 {
+		cfg.CheckTimeout = 2 * time.Second
+	}
+	if cfg.HealthPath == "" {
+		cfg.HealthPath = "/healthz"
+	}
+	if cfg.ReadyPath == "" {
+		cfg.ReadyPath = "/readyz"
+	}
+	if cfg.CertReloadInterval == 0 {
+		cfg.CertReloadInterval = time.Minute
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	s := &Server{
+		cfg:    cfg,
+		logger: cfg.Logger,
+		checks: make(map[string]CheckFunc),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.HealthPath, s.healthz)
+	mux.HandleFunc(cfg.ReadyPath, s.readyz)
+	if handler != nil {
+		mux.Handle("/", handler)
+	}
+
+	s.srv = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		TLSConfig:         cfg.TLSConfig,
+		ErrorLog:          slog.NewLogLogger(cfg.Logger.Handler(), slog.LevelError),
+	}
+	if cfg.UnencryptedHTTP2 {
+		s.srv.Protocols = new(http.Protocols)
+		s.srv.Protocols.SetHTTP1(true)
+		s.srv.Protocols.SetHTTP2(true)
+		s.srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return s
+}
+
+// HTTPServer - Returns the underlying http.Server for further tuning before starting
+func (s *Server) HTTPServer() *http.Server {
+	return s.srv
+}
+
+// AddReadinessCheck - Registers a dependency check run by the readiness endpoint
+func (s *Server) AddReadinessCheck(name string, check CheckFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks[name] = check
+}
+
+const (
+	readyUnset int32 = iota
+	readyOn
+	readyOff
+)
+
+// SetReady - Marks the server ready or not ready independently of the readiness checks.
+// Serve marks the server ready when it starts, unless SetReady was called before.
+func (s *Server) SetReady(ready bool) {
+	if ready {
+		s.ready.Store(readyOn)
+		return
+	}
+	s.ready.Store(readyOff)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	results := make(map[string]string)
+
+	if s.draining.Load() {
+		status = http.StatusServiceUnavailable
+		results["server"] = "shutting down"
+	} else if s.ready.Load() != readyOn {
+		status = http.StatusServiceUnavailable
+		results["server"] = "not ready"
+	} else {
+		for name, err := range s.runChecks(r.Context()) {
+			if err != nil {
+				status = http.StatusServiceUnavailable
+				results[name] = err.Error()
+				continue
+			}
+			results[name] = "ok"
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(results)
+}
+
+// runChecks runs all readiness checks concurrently, each with its own timeout
+func (s *Server) runChecks(ctx context.Context) map[string]error {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = s.checks[name]
+	}
+	s.mu.RUnlock()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, s.cfg.CheckTimeout)
+			defer cancel()
+			errs[i] = checks[i](cctx)
+		}(i)
+	}
+	wg.Wait()
+
+	results := make(map[string]error, len(names))
+	for i, name := range names {
+		results[name] = errs[i]
+	}
+	return results
+}
+
+// ListenAndServe - Serves until SIGINT or SIGTERM is received, then drains in-flight requests
+func (s *Server) ListenAndServe() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return s.Run(ctx)
+}
+
+// Run - Serves until ctx is cancelled, then drains in-flight requests within ShutdownTimeout
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %v", s.cfg.Addr, err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve - Same as Run on an existing listener
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if s.cfg.CertFile != "" && s.cfg.KeyFile != "" {
+		cert, err := newCertReloader(s.cfg.CertFile, s.cfg.KeyFile)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		s.cert = cert
+		go cert.watch(ctx, s.cfg.CertReloadInterval, s.logger)
+
+		tlsConfig := s.srv.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		tlsConfig.GetCertificate = cert.getCertificate
+		s.srv.TLSConfig = tlsConfig
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Info("http server listening", slog.String("addr", ln.Addr().String()), slog.Bool("tls", s.cert != nil))
+		if s.cert != nil {
+			errCh <- s.srv.ServeTLS(ln, "", "")
+			return
+		}
+		errCh <- s.srv.Serve(ln)
+	}()
+	s.ready.CompareAndSwap(readyUnset, readyOn)
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	return s.shutdown(errCh)
+}
+
+// shutdown fails readiness, waits ShutdownDelay for load balancers to notice and drains connections
+func (s *Server) shutdown(errCh chan error) error {
+	s.draining.Store(true)
+	s.logger.Info("http server shutting down", slog.Duration("timeout", s.cfg.ShutdownTimeout))
+	if s.cfg.ShutdownDelay > 0 {
+		time.Sleep(s.cfg.ShutdownDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.srv.Close()
+		return fmt.Errorf("error draining http server: %v", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	s.logger.Info("http server stopped")
+	return nil
+}
+
+// Shutdown - Gracefully stops a server started with Serve or Run
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	return s.srv.Shutdown(ctx)
+}
+
+// certReloader serves a TLS certificate that is reloaded when its files change
+type certReloader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+	modTime           time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the key pair when either file changed, reporting whether it did
+func (c *certReloader) reload() (bool, error) {
+	modTime := time.Time{}
+	for _, f := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return false, fmt.Errorf("error reading certificate %s: %v", f, err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if !modTime.After(c.modTime) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("error loading certificate %s: %v", c.certFile, err)
+	}
+	c.cert.Store(&cert)
+	c.modTime = modTime
+	return true, nil
+}
+
+func (c *certReloader) watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				// Keep serving the previous certificate until the files are valid again
+				logger.Error("tls certificate reload failed", slog.String("error", err.Error()))
+			} else if reloaded {
+				logger.Info("tls certificate reloaded", slog.String("cert", c.certFile))
+			}
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
@@ -0,0 +1,64 @@
+package nethttp
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func startTestServer(t *testing.T, s *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return "http://" + ln.Addr().String()
+}
+
+func readyStatus(t *testing.T, url string) int {
+	t.Helper()
+	resp, err := http.Get(url + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func testServer() *Server {
+	return NewServer(ServerConfig{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, nil)
+}
+
+func TestServeMarksReady(t *testing.T) {
+	s := testServer()
+	url := startTestServer(t, s)
+	if code := readyStatus(t, url); code != http.StatusOK {
+		t.Errorf("readyz = %d, want 200", code)
+	}
+}
+
+func TestServeKeepsExplicitReadiness(t *testing.T) {
+	s := testServer()
+	s.SetReady(false)
+	url := startTestServer(t, s)
+	if code := readyStatus(t, url); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before SetReady(true) = %d, want 503", code)
+	}
+	s.SetReady(true)
+	if code := readyStatus(t, url); code != http.StatusOK {
+		t.Errorf("readyz after SetReady(true) = %d, want 200", code)
+	}
+}
@@ -0,0 +1,348 @@
+package nethttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStreamLine is the longest line accepted by the stream decoders
+const maxStreamLine = 1 << 20
+
+// Stream - Sends a request without the client timeout and returns the response for incremental reading.
+// Non 2xx responses are returned as errors; the caller must close the body.
+func (c *Client) Stream(ctx context.Context, method, url string, headers map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	streaming := *c.HTTPClient
+	streaming.Timeout = 0
+	resp, err := streaming.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return resp, &StatusError{StatusCode: resp.StatusCode, Body: data}
+	}
+	return resp, nil
+}
+
+// StatusError - Error returned for unexpected response status codes
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, string(e.Body))
+}
+
+// Lines - Iterates over the lines of r, accepting \n, \r\n and \r line endings
+func Lines(r io.Reader) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 4096), maxStreamLine)
+		scanner.Split(scanLines)
+		for scanner.Scan() {
+			if !yield(scanner.Text(), nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield("", err)
+		}
+	}
+}
+
+// NDJSON - Iterates over newline delimited JSON values of r, decoding each into T
+func NDJSON[T any](r io.Reader) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for line, err := range Lines(r) {
+			var v T
+			if err != nil {
+				yield(v, err)
+				return
+			}
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(line), &v); err != nil {
+				yield(v, fmt.Errorf("error decoding line: %v", err))
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// scanLines is bufio.ScanLines that also splits on a lone \r as required by the SSE spec
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// Need one more byte to know whether \r is followed by \n
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Event - Server-Sent Event
+type Event struct {
+	ID    string
+	Event string // defaults to "message" when received
+	Data  string
+	Retry time.Duration
+}
+
+// SSEClient - Server-Sent Events subscriber that reconnects and resumes with Last-Event-ID
+type SSEClient struct {
+	URL         string
+	Headers     map[string]string
+	Client      *Client       // default DefaultClient
+	LastEventID string        // updated as events are received
+	Retry       time.Duration // reconnection delay, default 3s, may be changed by the server
+	MaxRetries  int           // consecutive failed connections before giving up, 0 retries forever
+}
+
+// Subscribe - Calls fn for every received event until ctx is cancelled, fn returns an error,
+// the server answers 204 or a client error, or MaxRetries consecutive connections fail
+func (s *SSEClient) Subscribe(ctx context.Context, fn func(Event) error) error {
+	client := s.Client
+	if client == nil {
+		client = DefaultClient
+	}
+	if s.Retry <= 0 {
+		s.Retry = 3 * time.Second
+	}
+
+	failures := 0
+	for {
+		received, err := s.connect(ctx, client, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var handlerErr *sseHandlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode != http.StatusTooManyRequests && statusErr.StatusCode < 500 {
+			return err
+		}
+		if err == errSSEDone {
+			return nil
+		}
+
+		if received {
+			failures = 0
+		} else if failures++; s.MaxRetries > 0 && failures >= s.MaxRetries {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("error subscribing to %s after %d attempts: %v", s.URL, failures, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.Retry):
+		}
+	}
+}
+
+var errSSEDone = errors.New("event stream closed by server")
+
+type sseHandlerError struct{ err error }
+
+func (e *sseHandlerError) Error() string { return e.err.Error() }
+
+// connect reads one connection, reporting whether any event was received
+func (s *SSEClient) connect(ctx context.Context, client *Client, fn func(Event) error) (bool, error) {
+	headers := map[string]string{
+		"Accept":        "text/event-stream",
+		"Cache-Control": "no-cache",
+	}
+	for k, v := range s.Headers {
+		headers[k] = v
+	}
+	if s.LastEventID != "" {
+		headers["Last-Event-ID"] = s.LastEventID
+	}
+
+	resp, err := client.Stream(ctx, "GET", s.URL, headers, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return false, errSSEDone
+	}
+
+	received := false
+	var (
+		data      strings.Builder
+		eventType string
+		first     = true
+	)
+	for line, err := range Lines(resp.Body) {
+		if err != nil {
+			return received, err
+		}
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		if line == "" {
+			if data.Len() == 0 {
+				eventType = ""
+				continue
+			}
+			ev := Event{
+				ID:    s.LastEventID,
+				Event: eventType,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+			}
+			if ev.Event == "" {
+				ev.Event = "message"
+			}
+			data.Reset()
+			eventType = ""
+			received = true
+			if err := fn(ev); err != nil {
+				return received, &sseHandlerError{err: err}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.LastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				s.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return received, nil
+}
+
+// SSEWriter - Writes Server-Sent Events to a response
+type SSEWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewSSEWriter - Starts an event stream response, disabling the server write timeout for it
+func NewSSEWriter(w http.ResponseWriter) (*SSEWriter, error) {
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Streams outlive the server WriteTimeout, not every writer supports deadlines
+	_ = rc.SetWriteDeadline(time.Time{})
+	if err := rc.Flush(); err != nil {
+		return nil, fmt.Errorf("response writer does not support streaming: %v", err)
+	}
+	return &SSEWriter{w: w, rc: rc}, nil
+}
+
+// LastEventID - Returns the Last-Event-ID sent by a reconnecting SSE client
+func LastEventID(r *http.Request) string {
+	return r.Header.Get("Last-Event-ID")
+}
+
+// Send - Writes and flushes an event
+func (s *SSEWriter) Send(ev Event) error {
+	var buf bytes.Buffer
+	if ev.ID != "" {
+		buf.WriteString("id: " + stripNewlines(ev.ID) + "\n")
+	}
+	if ev.Event != "" {
+		buf.WriteString("event: " + stripNewlines(ev.Event) + "\n")
+	}
+	if ev.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	data := strings.Replace(strings.Replace(ev.Data, "\r\n", "\n", -1), "\r", "\n", -1)
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// SendJSON - Sends v encoded as JSON in the data field
+func (s *SSEWriter) SendJSON(id, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Send(Event{ID: id, Event: event, Data: string(data)})
+}
+
+// Comment - Writes a comment line, useful as a keep-alive
+func (s *SSEWriter) Comment(text string) error {
+	if _, err := s.w.Write([]byte(": " + stripNewlines(text) + "\n\n")); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
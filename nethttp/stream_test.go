@@ -0,0 +1,269 @@
+package nethttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"lf", "a\nb\n", []string{"a", "b"}},
+		{"crlf", "a\r\nb\r\n", []string{"a", "b"}},
+		{"cr", "a\rb\r", []string{"a", "b"}},
+		{"mixed", "a\nb\r\nc\rd", []string{"a", "b", "c", "d"}},
+		{"empty lines", "a\r\n\r\n\rb", []string{"a", "", "", "b"}},
+		{"trailing cr", "a\r", []string{"a"}},
+		{"no newline", "a", []string{"a"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		// One byte reads make \r the last byte of the buffer
+		for _, r := range []io.Reader{strings.NewReader(tt.input), iotest.OneByteReader(strings.NewReader(tt.input))} {
+			var got []string
+			for line, err := range Lines(r) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: Lines = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLinesTooLong(t *testing.T) {
+	var err error
+	for _, err = range Lines(strings.NewReader(strings.Repeat("x", maxStreamLine+1))) {
+	}
+	if err == nil {
+		t.Error("no error for a line longer than maxStreamLine")
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	type item struct {
+		N int `json:"n"`
+	}
+	var got []int
+	for v, err := range NDJSON[item](strings.NewReader("{\"n\":1}\r\n\n  \n{\"n\":2}\n{\"n\":3}\n")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v.N)
+		if v.N == 2 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("NDJSON = %v, want [1 2]", got)
+	}
+
+	var errs []error
+	for _, err := range NDJSON[item](strings.NewReader("{\"n\":1}\nnot json\n{\"n\":3}\n")) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 2 || errs[0] != nil || errs[1] == nil || !strings.Contains(errs[1].Error(), "error decoding line") {
+		t.Errorf("NDJSON errors = %v, want to stop at the invalid line", errs)
+	}
+}
+
+func TestStreamStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := DefaultClient.Stream(context.Background(), "GET", srv.URL, nil, nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden || string(statusErr.Body) != "nope\n" {
+		t.Errorf("Stream = %v, want a 403 StatusError", err)
+	}
+}
+
+func TestSSEWriterAndClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sse, err := NewSSEWriter(w)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sse.Comment("keep-alive")
+		sse.Send(Event{ID: "1", Data: "first"})
+		sse.Send(Event{ID: "2\n", Event: "update", Data: "multi\r\nline\rdata"})
+		sse.SendJSON("3", "json", map[string]int{"n": 3})
+	}))
+	defer srv.Close()
+
+	var got []Event
+	c := &SSEClient{URL: srv.URL}
+	err := c.Subscribe(context.Background(), func(ev Event) error {
+		got = append(got, ev)
+		if len(got) == 3 {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != io.EOF {
+		t.Fatalf("Subscribe = %v, want the handler error", err)
+	}
+	want := []Event{
+		{ID: "1", Event: "message", Data: "first"},
+		{ID: "2", Event: "update", Data: "multi\nline\ndata"},
+		{ID: "3", Event: "json", Data: `{"n":3}`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+	if c.LastEventID != "3" {
+		t.Errorf("LastEventID = %q, want 3", c.LastEventID)
+	}
+}
+
+func TestSSEClientParsing(t *testing.T) {
+	const stream = "\ufeff: comment\r\n" +
+		"retry: 1500\r\n" +
+		"event: greeting\r\n" +
+		"data:hello\r\n" +
+		"data: world\r\n" +
+		"id: 7\r\n" +
+		"\r\n" +
+		"id: bad\x00id\r" +
+		"data\r" +
+		"\r" +
+		"event: ignored\n" +
+		"\n" +
+		"unknown: field\n" +
+		"data: last\n" +
+		"\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, stream)
+	}))
+	defer srv.Close()
+
+	var got []Event
+	c := &SSEClient{URL: srv.URL}
+	c.Subscribe(context.Background(), func(ev Event) error {
+		got = append(got, ev)
+		if len(got) == 3 {
+			return io.EOF
+		}
+		return nil
+	})
+	want := []Event{
+		{ID: "7", Event: "greeting", Data: "hello\nworld"},
+		// An id with NUL is ignored and "data" without a colon is an empty data line
+		{ID: "7", Event: "message", Data: ""},
+		// An event without data is dropped
+		{ID: "7", Event: "message", Data: "last"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+	if c.Retry != 1500*time.Millisecond {
+		t.Errorf("Retry = %v, want 1.5s", c.Retry)
+	}
+}
+
+func TestSSEClientReconnects(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		lastIDs  []string
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		mu.Unlock()
+		switch n {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "retry: 10\nid: 1\ndata: one\n\n")
+		case 2:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case 3:
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "id: 2\ndata: two\n\n")
+		default:
+			// No content tells the client to stop reconnecting
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	var data []string
+	c := &SSEClient{URL: srv.URL}
+	err := c.Subscribe(context.Background(), func(ev Event) error {
+		data = append(data, ev.Data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe = %v, want nil after 204", err)
+	}
+	if !reflect.DeepEqual(data, []string{"one", "two"}) {
+		t.Errorf("data = %q", data)
+	}
+	if want := []string{"", "1", "1", "2"}; !reflect.DeepEqual(lastIDs, want) {
+		t.Errorf("Last-Event-ID = %q, want %q", lastIDs, want)
+	}
+}
+
+func TestSSEClientGivesUp(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := &SSEClient{URL: srv.URL, Retry: time.Millisecond, MaxRetries: 3}
+	err := c.Subscribe(context.Background(), func(Event) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") || attempts != 3 {
+		t.Errorf("Subscribe = %v after %d attempts", err, attempts)
+	}
+
+	// Client errors are not retried
+	attempts = 0
+	c = &SSEClient{URL: srv.URL + "/missing", Retry: time.Millisecond}
+	err = c.Subscribe(context.Background(), func(Event) error { return nil })
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || attempts != 1 {
+		t.Errorf("Subscribe = %v after %d attempts, want a 404 StatusError", err, attempts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c = &SSEClient{URL: srv.URL, Retry: time.Millisecond}
+	if err := c.Subscribe(ctx, func(Event) error { return nil }); err != context.DeadlineExceeded {
+		t.Errorf("Subscribe = %v, want the context error", err)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Last-Event-ID", "42")
+	if id := LastEventID(r); id != "42" {
+		t.Errorf("LastEventID = %q", id)
+	}
+}
@@ -0,0 +1,201 @@
+//go:build ignore
+
+// Generates the MMDB test databases used by geoip_test.go:
+//
+//	go run testdata/gen_geoip.go
+//
+// Only documentation ranges (RFC 5737, RFC 3849) and private ASNs (RFC 6996) are used.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+type network struct {
+	prefix string
+	record map[string]interface{}
+}
+
+func names(en string) map[string]interface{} {
+	return map[string]interface{}{"en": en}
+}
+
+var cityDB = []network{
+	{"203.0.113.0/24", map[string]interface{}{
+		"city":    map[string]interface{}{"names": names("Berlin")},
+		"country": map[string]interface{}{"iso_code": "DE", "names": names("Germany")},
+	}},
+	{"198.51.100.0/24", map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "FR", "names": names("France")},
+	}},
+	{"2001:db8::/32", map[string]interface{}{
+		"city":    map[string]interface{}{"names": names("Tokyo")},
+		"country": map[string]interface{}{"iso_code": "JP", "names": names("Japan")},
+	}},
+}
+
+var asnDB = []network{
+	{"203.0.113.0/24", map[string]interface{}{
+		"autonomous_system_number":       uint32(64500),
+		"autonomous_system_organization": "Example Telecom",
+	}},
+	{"2001:db8::/32", map[string]interface{}{
+		"autonomous_system_number":       uint32(64501),
+		"autonomous_system_organization": "Example Net",
+	}},
+}
+
+func main() {
+	write("testdata/geoip-city-test.mmdb", "GeoIP2-City", cityDB)
+	write("testdata/geoip-asn-test.mmdb", "GeoLite2-ASN", asnDB)
+}
+
+// node - Search tree node, a child is another node, a data offset or empty
+type node struct {
+	child [2]*node
+	data  [2]int // data offset + 1, 0 is empty
+	id    int
+}
+
+func write(path, dbType string, networks []network) {
+	var data bytes.Buffer
+	root := &node{}
+	for _, n := range networks {
+		prefix := netip.MustParsePrefix(n.prefix)
+		bits := prefix.Bits()
+		addr := prefix.Addr().As16()
+		if prefix.Addr().Is4() {
+			// IPv4 networks live in ::/96 of an IPv6 tree
+			addr = [16]byte{12: addr[12], 13: addr[13], 14: addr[14], 15: addr[15]}
+			bits += 96
+		}
+		offset := data.Len()
+		encode(&data, n.record)
+
+		cur := root
+		for i := 0; i < bits; i++ {
+			bit := addr[i/8] >> (7 - uint(i%8)) & 1
+			if i == bits-1 {
+				cur.data[bit] = offset + 1
+				break
+			}
+			if cur.child[bit] == nil {
+				cur.child[bit] = &node{}
+			}
+			cur = cur.child[bit]
+		}
+	}
+
+	var nodes []*node
+	var number func(*node)
+	number = func(n *node) {
+		n.id = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.child {
+			if c != nil {
+				number(c)
+			}
+		}
+	}
+	number(root)
+	count := len(nodes)
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for bit := 0; bit < 2; bit++ {
+			value := count // empty
+			switch {
+			case n.child[bit] != nil:
+				value = n.child[bit].id
+			case n.data[bit] != 0:
+				value = count + 16 + n.data[bit] - 1
+			}
+			out.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	encode(&out, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               dbType,
+		"description":                 map[string]interface{}{"en": "go-libs nethttp test database"},
+		"ip_version":                  uint16(6),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+	})
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// encode - Writes v in the MMDB data section format
+func encode(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		control(buf, 2, len(v))
+		buf.WriteString(v)
+	case uint16:
+		writeUint(buf, 5, uint64(v))
+	case uint32:
+		writeUint(buf, 6, uint64(v))
+	case uint64:
+		writeUint(buf, 9, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		control(buf, 7, len(v))
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, v[k])
+		}
+	case []interface{}:
+		control(buf, 11, len(v))
+		for _, e := range v {
+			encode(buf, e)
+		}
+	default:
+		log.Fatalf("unsupported type %T", v)
+	}
+}
+
+func writeUint(buf *bytes.Buffer, typ int, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	i := 0
+	for i < 8 && b[i] == 0 {
+		i++
+	}
+	control(buf, typ, 8-i)
+	buf.Write(b[i:])
+}
+
+func control(buf *bytes.Buffer, typ, size int) {
+	var extra []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		extra = []byte{byte(size - 29)}
+		size = 29
+	default:
+		log.Fatalf("size %d not supported", size)
+	}
+	if typ <= 7 {
+		buf.WriteByte(byte(typ<<5 | size))
+	} else {
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(typ - 7))
+	}
+	buf.Write(extra)
+}
@@ -0,0 +1,341 @@
+package nethttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Device types reported in DeviceInfo
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// DeviceInfo - Structured device details of a client
+type DeviceInfo struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browserVersion,omitempty"`
+	OS             string `json:"os"`
+	OSVersion      string `json:"osVersion,omitempty"`
+	DeviceType     string `json:"deviceType"`
+	Model          string `json:"model,omitempty"`
+	IsBot          bool   `json:"isBot"`
+	UserAgent      string `json:"userAgent,omitempty"`
+}
+
+// UARule - Regex rule matched against a user agent.
+// Name and Version are templates that may refer to capture groups, e.g. "$1".
+type UARule struct {
+	Regex   string `json:"regex"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// UADeviceRule - Regex rule mapping a user agent to a device type
+type UADeviceRule struct {
+	Regex string `json:"regex"`
+	Type  string `json:"type"`
+}
+
+// UARules - Rule set of a UAParser, the first matching rule of each list wins
+type UARules struct {
+	Bots     []UARule       `json:"bots"`
+	Browsers []UARule       `json:"browsers"`
+	OS       []UARule       `json:"os"`
+	Devices  []UADeviceRule `json:"devices"`
+}
+
+// DefaultUARules - Built-in rules covering the common browsers, operating systems and crawlers
+var DefaultUARules = UARules{
+	Bots: []UARule{
+		{Regex: `(Googlebot|bingbot|Slurp|DuckDuckBot|Baiduspider|YandexBot|facebookexternalhit|Twitterbot|LinkedInBot|Applebot|AhrefsBot|SemrushBot|GPTBot)/?(\d+(?:\.\d+)*)?`, Name: "$1", Version: "$2"},
+		{Regex: `(curl|Wget|python-requests|Go-http-client|okhttp|PostmanRuntime|Apache-HttpClient)/(\d+(?:\.\d+)*)`, Name: "$1", Version: "$2"},
+		{Regex: `(?i)(?:bot\b|crawler|spider|crawling|headless)`, Name: "Bot"},
+	},
+	Browsers: []UARule{
+		{Regex: `Edg(?:e|A|iOS)?/(\d+(?:\.\d+)*)`, Name: "Edge"},
+		{Regex: `(?:OPR|Opera)/(\d+(?:\.\d+)*)`, Name: "Opera"},
+		{Regex: `SamsungBrowser/(\d+(?:\.\d+)*)`, Name: "Samsung Internet"},
+		{Regex: `YaBrowser/(\d+(?:\.\d+)*)`, Name: "Yandex Browser"},
+		{Regex: `(?:Chrome|CriOS)/(\d+(?:\.\d+)*)`, Name: "Chrome"},
+		{Regex: `(?:Firefox|FxiOS)/(\d+(?:\.\d+)*)`, Name: "Firefox"},
+		{Regex: `Version/(\d+(?:\.\d+)*).*Safari/`, Name: "Safari"},
+		{Regex: `(?:MSIE |Trident/.*rv:)(\d+(?:\.\d+)*)`, Name: "Internet Explorer"},
+	},
+	OS: []UARule{
+		{Regex: `Windows Phone (?:OS )?(\d+(?:\.\d+)*)`, Name: "Windows Phone"},
+		{Regex: `Windows NT (\d+\.\d+)`, Name: "Windows"},
+		{Regex: `(?:iPhone|iPad|iPod).*? OS (\d+(?:_\d+)*)`, Name: "iOS"},
+		{Regex: `Android (\d+(?:\.\d+)*)`, Name: "Android"},
+		{Regex: `Mac OS X (\d+(?:[_.]\d+)*)`, Name: "macOS"},
+		{Regex: `CrOS \S+ (\d+(?:\.\d+)*)`, Name: "Chrome OS"},
+		{Regex: `Ubuntu`, Name: "Ubuntu"},
+		{Regex: `Linux`, Name: "Linux"},
+	},
+	Devices: []UADeviceRule{
+		{Regex: `iPad|PlayBook|Tablet|Kindle|Silk/`, Type: DeviceTablet},
+		{Regex: `Mobi|iPhone|iPod|Android.*Mobile|Windows Phone|BlackBerry|Opera Mini`, Type: DeviceMobile},
+		{Regex: `Android`, Type: DeviceTablet},
+	},
+}
+
+type compiledUARule struct {
+	re      *regexp.Regexp
+	name    string
+	version string
+}
+
+type compiledDeviceRule struct {
+	re  *regexp.Regexp
+	typ string
+}
+
+// UAParser - Parses user agents and client hints into DeviceInfo using a replaceable rule set
+type UAParser struct {
+	mu       sync.RWMutex
+	bots     []compiledUARule
+	browsers []compiledUARule
+	os       []compiledUARule
+	devices  []compiledDeviceRule
+}
+
+// DefaultUAParser - Parser used by GetDeviceInfoFromReq
+var DefaultUAParser = MustUAParser(DefaultUARules)
+
+// NewUAParser - Creates a parser from a rule set
+func NewUAParser(rules UARules) (*UAParser, error) {
+	p := &UAParser{}
+	if err := p.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MustUAParser - Same as NewUAParser but panics on invalid rules
+func MustUAParser(rules UARules) *UAParser {
+	p, err := NewUAParser(rules)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// LoadUARules - Reads a JSON rule set from a data file
+func LoadUARules(path string) (UARules, error) {
+	var rules UARules
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return rules, fmt.Errorf("error reading user agent rules %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("error decoding user agent rules %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// LoadFile - Replaces the rules of the parser with the rules of a JSON data file
+func (p *UAParser) LoadFile(path string) error {
+	rules, err := LoadUARules(path)
+	if err != nil {
+		return err
+	}
+	return p.SetRules(rules)
+}
+
+// SetRules - Compiles and replaces the rules of the parser
+func (p *UAParser) SetRules(rules UARules) error {
+	bots, err := compileUARules(rules.Bots)
+	if err != nil {
+		return err
+	}
+	browsers, err := compileUARules(rules.Browsers)
+	if err != nil {
+		return err
+	}
+	oses, err := compileUARules(rules.OS)
+	if err != nil {
+		return err
+	}
+	var devices []compiledDeviceRule
+	for _, r := range rules.Devices {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid device rule %s: %v", r.Regex, err)
+		}
+		devices = append(devices, compiledDeviceRule{re: re, typ: r.Type})
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bots, p.browsers, p.os, p.devices = bots, browsers, oses, devices
+	return nil
+}
+
+func compileUARules(rules []UARule) ([]compiledUARule, error) {
+	var compiled []compiledUARule
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user agent rule %s: %v", r.Regex, err)
+		}
+		version := r.Version
+		if version == "" && re.NumSubexp() > 0 && !strings.Contains(r.Name, "$1") {
+			version = "$1"
+		}
+		compiled = append(compiled, compiledUARule{re: re, name: r.Name, version: version})
+	}
+	return compiled, nil
+}
+
+// match returns the expanded name and version of the first matching rule
+func match(rules []compiledUARule, ua string) (string, string, bool) {
+	for _, r := range rules {
+		m := r.re.FindStringSubmatchIndex(ua)
+		if m == nil {
+			continue
+		}
+		name := string(r.re.ExpandString(nil, r.name, ua, m))
+		version := string(r.re.ExpandString(nil, r.version, ua, m))
+		return name, version, true
+	}
+	return "", "", false
+}
+
+// Parse - Parses a user agent string
+func (p *UAParser) Parse(ua string) DeviceInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	info := DeviceInfo{
+		Browser:    "Unknown",
+		OS:         "Unknown",
+		DeviceType: DeviceDesktop,
+		UserAgent:  ua,
+	}
+	if ua == "" {
+		return info
+	}
+
+	if name, version, ok := match(p.bots, ua); ok {
+		info.IsBot = true
+		info.DeviceType = DeviceBot
+		info.Browser, info.BrowserVersion = name, version
+	} else if name, version, ok := match(p.browsers, ua); ok {
+		info.Browser, info.BrowserVersion = name, version
+	}
+
+	if name, version, ok := match(p.os, ua); ok {
+		info.OS, info.OSVersion = name, strings.Replace(version, "_", ".", -1)
+	}
+
+	if !info.IsBot {
+		for _, r := range p.devices {
+			if r.re.MatchString(ua) {
+				info.DeviceType = r.typ
+				break
+			}
+		}
+	}
+	return info
+}
+
+// ParseRequest - Parses the User-Agent header and applies Sec-CH-UA client hints when present
+func (p *UAParser) ParseRequest(r *http.Request) DeviceInfo {
+	info := p.Parse(r.Header.Get("User-Agent"))
+	if info.IsBot {
+		return info
+	}
+
+	brands := r.Header.Get("Sec-CH-UA-Full-Version-List")
+	if brands == "" {
+		brands = r.Header.Get("Sec-CH-UA")
+	}
+	if name, version := pickBrand(brands); name != "" {
+		info.Browser, info.BrowserVersion = name, version
+	}
+
+	if platform := unquoteHint(r.Header.Get("Sec-CH-UA-Platform")); platform != "" {
+		// macOS user agents are frozen at 10.15.7, only trust the hinted version
+		if platform == "macOS" || platform != info.OS {
+			info.OSVersion = ""
+		}
+		info.OS = platform
+		if version := unquoteHint(r.Header.Get("Sec-CH-UA-Platform-Version")); version != "" {
+			info.OSVersion = version
+		}
+	}
+
+	if model := unquoteHint(r.Header.Get("Sec-CH-UA-Model")); model != "" {
+		info.Model = model
+	}
+	switch r.Header.Get("Sec-CH-UA-Mobile") {
+	case "?1":
+		info.DeviceType = DeviceMobile
+	case "?0":
+		if info.DeviceType == DeviceMobile {
+			info.DeviceType = DeviceDesktop
+		}
+	}
+	return info
+}
+
+// pickBrand returns the most specific brand of a Sec-CH-UA list, skipping GREASE and Chromium
+func pickBrand(header string) (string, string) {
+	var name, version string
+	for _, entry := range splitQuoted(header, ',') {
+		// GREASE brands such as "Not)A;Brand" may contain the separators
+		parts := splitQuoted(entry, ';')
+		brand := unquoteHint(parts[0])
+		if brand == "" || isGreaseBrand(brand) {
+			continue
+		}
+		v := ""
+		for _, param := range parts[1:] {
+			if k, val, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "v" {
+				v = unquoteHint(val)
+			}
+		}
+		if brand == "Chromium" && name != "" {
+			continue
+		}
+		name, version = brand, v
+		if name != "Chromium" {
+			break
+		}
+	}
+	switch name {
+	case "Google Chrome":
+		name = "Chrome"
+	case "Microsoft Edge":
+		name = "Edge"
+	}
+	return name, version
+}
+
+// isGreaseBrand reports whether brand is one of the random brands Chromium adds to
+// Sec-CH-UA, e.g. "Not A(Brand", "Not)A;Brand" or "Not_A Brand"
+func isGreaseBrand(brand string) bool {
+	return strings.Contains(brand, "Not") && strings.HasSuffix(brand, "Brand")
+}
+
+// unquoteHint removes the quotes of a structured header string
+func unquoteHint(s string) string {
+	s = strings.TrimSpace(s)
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return strings.Trim(s, `"`)
+}
+
+// GetDeviceInfoFromReq return client's browser, OS and device type parsed with DefaultUAParser.
+func GetDeviceInfoFromReq(r *http.Request) DeviceInfo {
+	return DefaultUAParser.ParseRequest(r)
+}
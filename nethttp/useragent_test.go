@@ -0,0 +1,163 @@
+package nethttp
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPickBrand(t *testing.T) {
+	tests := []struct {
+		header  string
+		name    string
+		version string
+	}{
+		// Chrome 116, the GREASE brand contains a semicolon
+		{`"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`, "Chrome", "116"},
+		{`"Not)A;Brand";v="99.0.0.0", "Microsoft Edge";v="116.0.1938.69", "Chromium";v="116.0.5845.188"`, "Edge", "116.0.1938.69"},
+		{`" Not A;Brand";v="99", "Chromium";v="90", "Google Chrome";v="90"`, "Chrome", "90"},
+		{`"Not_A Brand";v="8", "Chromium";v="120"`, "Chromium", "120"},
+		{`"Not/A)Brand";v="8", "Chromium";v="126", "Brave";v="126"`, "Brave", "126"},
+		{`"Not=A?Brand";v="24"`, "", ""},
+		{``, "", ""},
+	}
+	for _, tt := range tests {
+		name, version := pickBrand(tt.header)
+		if name != tt.name || version != tt.version {
+			t.Errorf("pickBrand(%s) = %q, %q, want %q, %q", tt.header, name, version, tt.name, tt.version)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want DeviceInfo
+	}{
+		{"", DeviceInfo{Browser: "Unknown", OS: "Unknown", DeviceType: DeviceDesktop}},
+		// Desktop
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Windows", OSVersion: "10.0", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			DeviceInfo{Browser: "Edge", BrowserVersion: "120.0.2210.91", OS: "Windows", OSVersion: "10.0", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 OPR/105.0.0.0",
+			DeviceInfo{Browser: "Opera", BrowserVersion: "105.0.0.0", OS: "Windows", OSVersion: "10.0", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			DeviceInfo{Browser: "Internet Explorer", BrowserVersion: "11.0", OS: "Windows", OSVersion: "6.1", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			DeviceInfo{Browser: "Safari", BrowserVersion: "17.2", OS: "macOS", OSVersion: "10.15.7", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+			DeviceInfo{Browser: "Firefox", BrowserVersion: "121.0", OS: "macOS", OSVersion: "10.15", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			DeviceInfo{Browser: "Firefox", BrowserVersion: "121.0", OS: "Ubuntu", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Chrome OS", OSVersion: "14541.0.0", DeviceType: DeviceDesktop}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 YaBrowser/23.11.0.0 Safari/537.36",
+			DeviceInfo{Browser: "Yandex Browser", BrowserVersion: "23.11.0.0", OS: "Windows", OSVersion: "10.0", DeviceType: DeviceDesktop}},
+		// Mobile
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			DeviceInfo{Browser: "Safari", BrowserVersion: "17.2", OS: "iOS", OSVersion: "17.2", DeviceType: DeviceMobile}},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.6099.119", OS: "iOS", OSVersion: "17.2", DeviceType: DeviceMobile}},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/121.0 Mobile/15E148 Safari/605.1.15",
+			DeviceInfo{Browser: "Firefox", BrowserVersion: "121.0", OS: "iOS", OSVersion: "17.2", DeviceType: DeviceMobile}},
+		{"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", OSVersion: "10", DeviceType: DeviceMobile}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			DeviceInfo{Browser: "Samsung Internet", BrowserVersion: "23.0", OS: "Android", OSVersion: "13", DeviceType: DeviceMobile}},
+		{"Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0",
+			DeviceInfo{Browser: "Firefox", BrowserVersion: "121.0", OS: "Android", OSVersion: "14", DeviceType: DeviceMobile}},
+		{"Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.14977",
+			DeviceInfo{Browser: "Edge", BrowserVersion: "15.14977", OS: "Windows Phone", OSVersion: "10.0", DeviceType: DeviceMobile}},
+		// Tablet
+		{"Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			DeviceInfo{Browser: "Safari", BrowserVersion: "17.2", OS: "iOS", OSVersion: "17.2", DeviceType: DeviceTablet}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", OSVersion: "13", DeviceType: DeviceTablet}},
+		// Bots
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			DeviceInfo{Browser: "Googlebot", BrowserVersion: "2.1", OS: "Unknown", DeviceType: DeviceBot, IsBot: true}},
+		{"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.6045.199 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			DeviceInfo{Browser: "Googlebot", BrowserVersion: "2.1", OS: "Android", OSVersion: "6.0.1", DeviceType: DeviceBot, IsBot: true}},
+		{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+			DeviceInfo{Browser: "bingbot", BrowserVersion: "2.0", OS: "Unknown", DeviceType: DeviceBot, IsBot: true}},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			DeviceInfo{Browser: "facebookexternalhit", BrowserVersion: "1.1", OS: "Unknown", DeviceType: DeviceBot, IsBot: true}},
+		{"curl/8.4.0", DeviceInfo{Browser: "curl", BrowserVersion: "8.4.0", OS: "Unknown", DeviceType: DeviceBot, IsBot: true}},
+		{"Go-http-client/1.1", DeviceInfo{Browser: "Go-http-client", BrowserVersion: "1.1", OS: "Unknown", DeviceType: DeviceBot, IsBot: true}},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.6099.28 Safari/537.36",
+			DeviceInfo{Browser: "Bot", OS: "Linux", DeviceType: DeviceBot, IsBot: true}},
+	}
+	for _, tt := range tests {
+		tt.want.UserAgent = tt.ua
+		if got := DefaultUAParser.Parse(tt.ua); got != tt.want {
+			t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	const (
+		chromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+		chromeMac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+		chromeAndroid = "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+		googlebot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	)
+	tests := []struct {
+		name    string
+		ua      string
+		headers map[string]string
+		want    DeviceInfo
+	}{
+		{"no hints", chromeWindows, nil,
+			DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Windows", OSVersion: "10.0", DeviceType: DeviceDesktop}},
+		{"windows 11", chromeWindows, map[string]string{
+			"Sec-CH-UA":                  `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
+			"Sec-CH-UA-Mobile":           "?0",
+			"Sec-CH-UA-Platform":         `"Windows"`,
+			"Sec-CH-UA-Platform-Version": `"15.0.0"`,
+		}, DeviceInfo{Browser: "Chrome", BrowserVersion: "120", OS: "Windows", OSVersion: "15.0.0", DeviceType: DeviceDesktop}},
+		{"full version list", chromeWindows, map[string]string{
+			"Sec-CH-UA":                   `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
+			"Sec-CH-UA-Full-Version-List": `"Not_A Brand";v="8.0.0.0", "Chromium";v="120.0.6099.130", "Google Chrome";v="120.0.6099.130"`,
+		}, DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.6099.130", OS: "Windows", OSVersion: "10.0", DeviceType: DeviceDesktop}},
+		{"edge brand", chromeWindows, map[string]string{
+			"Sec-CH-UA": `"Not_A Brand";v="8", "Chromium";v="120", "Microsoft Edge";v="120"`,
+		}, DeviceInfo{Browser: "Edge", BrowserVersion: "120", OS: "Windows", OSVersion: "10.0", DeviceType: DeviceDesktop}},
+		{"frozen macos version", chromeMac, map[string]string{
+			"Sec-CH-UA-Platform": `"macOS"`,
+		}, DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "macOS", DeviceType: DeviceDesktop}},
+		{"hinted macos version", chromeMac, map[string]string{
+			"Sec-CH-UA-Platform":         `"macOS"`,
+			"Sec-CH-UA-Platform-Version": `"14.2.1"`,
+		}, DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "macOS", OSVersion: "14.2.1", DeviceType: DeviceDesktop}},
+		{"reduced android", chromeAndroid, map[string]string{
+			"Sec-CH-UA":                  `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
+			"Sec-CH-UA-Mobile":           "?1",
+			"Sec-CH-UA-Platform":         `"Android"`,
+			"Sec-CH-UA-Platform-Version": `"14.0.0"`,
+			"Sec-CH-UA-Model":            `"Pixel 7"`,
+		}, DeviceInfo{Browser: "Chrome", BrowserVersion: "120", OS: "Android", OSVersion: "14.0.0", DeviceType: DeviceMobile, Model: "Pixel 7"}},
+		{"desktop site on a phone", chromeAndroid, map[string]string{
+			"Sec-CH-UA-Mobile": "?0",
+		}, DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", OSVersion: "10", DeviceType: DeviceDesktop}},
+		{"other platform", chromeWindows, map[string]string{
+			"Sec-CH-UA-Platform": `"Linux"`,
+		}, DeviceInfo{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Linux", DeviceType: DeviceDesktop}},
+		{"bots ignore hints", googlebot, map[string]string{
+			"Sec-CH-UA":          `"Chromium";v="120"`,
+			"Sec-CH-UA-Mobile":   "?1",
+			"Sec-CH-UA-Platform": `"Android"`,
+		}, DeviceInfo{Browser: "Googlebot", BrowserVersion: "2.1", OS: "Unknown", DeviceType: DeviceBot, IsBot: true}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", tt.ua)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		tt.want.UserAgent = tt.ua
+		if got := DefaultUAParser.ParseRequest(r); got != tt.want {
+			t.Errorf("%s: ParseRequest\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	redis "github.com/gomodule/redigo/redis"
+)
+
+// HTTPCacheStore - Stores nethttp.CachingTransport responses in redis so replicas share them
+type HTTPCacheStore struct {
+	pool   Session
+	prefix string
+}
+
+// NewHTTPCacheStore - Creates a store for nethttp.NewCachingTransport, which then caches as a shared cache
+func NewHTTPCacheStore(pool Session, prefix string) *HTTPCacheStore {
+	return &HTTPCacheStore{pool: pool, prefix: prefix}
+}
+
+// SharedCache - Responses are seen by every process using the same redis, so private ones must not be stored
+func (s *HTTPCacheStore) SharedCache() bool {
+	return true
+}
+
+// Get - Get
+func (s *HTTPCacheStore) Get(key string) ([]byte, bool, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", s.prefix+key))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting key %s: %v", key, err)
+	}
+	return data, true, nil
+}
+
+// Set - Set
+func (s *HTTPCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{s.prefix + key, value}
+	if ttl > 0 {
+		ms := ttl.Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", ms)
+	}
+	if _, err := conn.Do("SET", args...); err != nil {
+		return fmt.Errorf("error setting key %s: %v", key, err)
+	}
+	return nil
+}
+
+// Delete - Delete
+func (s *HTTPCacheStore) Delete(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", s.prefix+key); err != nil {
+		return fmt.Errorf("error deleting the key %s: %v", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	redis "github.com/gomodule/redigo/redis"
+)
+
+// ResumeTokenStore - Keeps mongodb change stream resume tokens in redis, implements mongodb.ResumeTokenStore
+type ResumeTokenStore struct {
+	pool   Session
+	prefix string
+}
+
+// NewResumeTokenStore - NewResumeTokenStore
+func NewResumeTokenStore(pool Session, prefix string) *ResumeTokenStore {
+	return &ResumeTokenStore{pool: pool, prefix: prefix}
+}
+
+// LoadToken - LoadToken
+func (s *ResumeTokenStore) LoadToken(ctx context.Context, key string) ([]byte, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", s.prefix+key))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting key %s: %v", key, err)
+	}
+	return data, nil
+}
+
+// SaveToken - SaveToken
+func (s *ResumeTokenStore) SaveToken(ctx context.Context, key string, token []byte) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", s.prefix+key, token); err != nil {
+		return fmt.Errorf("error setting key %s: %v", key, err)
+	}
+	return nil
+}